@@ -0,0 +1,197 @@
+package oam
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+
+	defaultMaxArchiveSize = 256 << 20
+)
+
+// archiveFiles is the contents of an extracted archive, by slash-separated path.
+type archiveFiles map[string][]byte
+
+// names returns the sorted paths of the files in the archive.
+func (a archiveFiles) names() []string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// archiveEntry is an archive being or done being extracted, in f.archives.
+// Its fields are set before done is closed.
+type archiveEntry struct {
+	done  chan struct{}
+	src   *fetched
+	files archiveFiles
+	err   error
+}
+
+// archive downloads and extracts the repo's archive, once per fetcher. Files
+// of the same asset fetched at the same time wait for the first to extract it.
+func (f *Fetcher) archive(ctx context.Context, repoName string, r Repo) (*fetched, archiveFiles, error) {
+	url, err := f.assetURL(ctx, r)
+	if err != nil {
+		return nil, nil, fetchError(repoName, r.Asset, err)
+	}
+	e := &archiveEntry{done: make(chan struct{})}
+	if v, loaded := f.archives.LoadOrStore(url, e); loaded {
+		e = v.(*archiveEntry)
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		if e.err != nil {
+			return nil, nil, e.err
+		}
+		src := *e.src
+		src.Cached, src.Duration, src.Timing = true, 0, Timing{}
+		return &src, e.files, nil
+	}
+
+	e.src, e.files, e.err = f.extractArchive(ctx, repoName, r)
+	if e.err != nil {
+		// Let a later run try again.
+		f.archives.Delete(url)
+	}
+	close(e.done)
+	return e.src, e.files, e.err
+}
+
+func (f *Fetcher) extractArchive(ctx context.Context, repoName string, r Repo) (*fetched, archiveFiles, error) {
+	src, err := f.download(ctx, repoName, r, r.Asset, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := extract(src.Data, r.Archive, f.maxArchiveSize())
+	if err != nil {
+		return nil, nil, &FetchError{Repo: repoName, Path: r.Asset, URL: src.URL, Err: fmt.Errorf("failed to extract: %w", err)}
+	}
+	f.logger().Debug("extracted archive", "repo", repoName, "asset", r.Asset, "files", len(files))
+	return src, files, nil
+}
+
+// downloadFromArchive returns the file at path in the repo's archive.
+func (f *Fetcher) downloadFromArchive(ctx context.Context, repoName string, r Repo, path string, validate bool) (*fetched, error) {
+	src, files, err := f.archive(ctx, repoName, r)
+	if err != nil {
+		return nil, err
+	}
+	url := src.URL + "#" + path
+	data, ok := files[path]
+	if !ok {
+		return nil, &FetchError{URL: url, Err: fmt.Errorf("not in %s", r.Asset)}
+	}
+	if validate {
+		if err := validateSpec(data); err != nil {
+			return nil, &FetchError{URL: url, Err: fmt.Errorf("invalid spec from %s: %w", url, err)}
+		}
+	}
+	return &fetched{Data: data, URL: url, Status: src.Status, Cached: src.Cached, Duration: src.Duration, Timing: src.Timing}, nil
+}
+
+func (f *Fetcher) maxArchiveSize() int64 {
+	if f.MaxArchiveSize > 0 {
+		return f.MaxArchiveSize
+	}
+	return defaultMaxArchiveSize
+}
+
+// extract reads the regular files in an archive of the given format. Entries
+// that would land outside the archive's root are rejected, as is an archive
+// whose files add up to more than max bytes.
+func extract(data []byte, format string, max int64) (archiveFiles, error) {
+	files := archiveFiles{}
+	var total int64
+	add := func(name string, r io.Reader) error {
+		clean, err := archivePath(name)
+		if err != nil {
+			return err
+		}
+		// Read one byte past the limit to tell a full archive from one too large.
+		b, err := io.ReadAll(io.LimitReader(r, max-total+1))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if total += int64(len(b)); total > max {
+			return fmt.Errorf("extracted files exceed %d bytes", max)
+		}
+		files[clean] = b
+		return nil
+	}
+
+	switch format {
+	case archiveTarGz:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return files, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if h.Typeflag != tar.TypeReg {
+				continue // Directories, and links that could point anywhere.
+			}
+			if err := add(h.Name, tr); err != nil {
+				return nil, err
+			}
+		}
+	case archiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = add(zf.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return files, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+}
+
+// archivePath cleans the name of an archive entry, rejecting absolute paths
+// and ones that climb out of the archive (zip slip).
+func archivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, ":") {
+		return "", fmt.Errorf("archive entry %q points outside the archive", name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,74 @@
+package oam
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testArchive returns a tar.gz archive of the files.
+func testArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRunExtractsArchiveOnce(t *testing.T) {
+	archive := testArchive(t, map[string]string{"specs/a.yaml": testSpec, "specs/b.yaml": testSpec, "specs/c.yaml": testSpec})
+	var downloads atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/repos/o/r/commits/tags/v1":
+			fmt.Fprintf(w, `{"sha":%q}`, testCommit)
+		case "/repos/o/r/releases/tags/v1":
+			fmt.Fprintf(w, `{"tag_name":"v1","assets":[{"name":"specs.tar.gz","url":"%s/assets/1"}]}`, srv.URL)
+		case "/assets/1":
+			downloads.Add(1)
+			// Long enough for every file to ask for the archive meanwhile.
+			time.Sleep(50 * time.Millisecond)
+			w.Write(archive)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"pets": {URL: "o/r", Version: "v1", RefType: refTag, Asset: "specs.tar.gz", Archive: archiveTarGz,
+			Path: Paths{"specs/a.yaml", "specs/b.yaml", "specs/c.yaml"}},
+	})
+	config.APIURL = srv.URL
+	result, err := testFetcher().Run(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 3 {
+		t.Errorf("fetched %d files, want 3", len(result.Files))
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("archive downloaded %d times, want once", n)
+	}
+}
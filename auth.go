@@ -0,0 +1,113 @@
+package oam
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// CredentialsFromEnv returns the GitHub username and token from
+// GITHUB_USERNAME and GITHUB_TOKEN. A token file, from tokenFile or
+// GITHUB_TOKEN_FILE, wins over GITHUB_TOKEN.
+func CredentialsFromEnv(tokenFile string) (username, token string, err error) {
+	username = os.Getenv("GITHUB_USERNAME")
+	token = os.Getenv("GITHUB_TOKEN")
+
+	if tokenFile == "" {
+		tokenFile = os.Getenv("GITHUB_TOKEN_FILE")
+	}
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read token file: %w", err)
+		}
+		token = strings.TrimRight(string(data), " \t\r\n")
+	}
+	return username, token, nil
+}
+
+// setAuth sets the authentication headers for private repositories, then the
+// repo's own headers.
+func (f *Fetcher) setAuth(req *http.Request, r Repo) error {
+	switch r.provider() {
+	case providerGitLab:
+		setGitLabAuth(req, r)
+	case providerBitbucket:
+		setBitbucketAuth(req, r)
+	default:
+		if err := f.setGitHubAuth(req, r); err != nil {
+			return err
+		}
+	}
+	for name, value := range r.Headers {
+		req.Header.Set(name, value)
+	}
+	return nil
+}
+
+// setGitHubAuth sends a per-repo token as a bearer token, and otherwise a
+// GitHub App installation token when the fetcher has an app. The global token
+// uses basic auth when a username is set and a bearer token otherwise. Without
+// a token, .netrc credentials for the request's host are used.
+func (f *Fetcher) setGitHubAuth(req *http.Request, r Repo) error {
+	if t := r.token(); t != "" {
+		req.Header.Set("Authorization", "Bearer "+t)
+		return nil
+	}
+	if f.App != nil {
+		t, err := f.appToken(req.Context(), r)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+t)
+		return nil
+	}
+
+	switch {
+	case f.Token == "":
+		if m, ok := f.Netrc.lookup(req.URL.Hostname()); ok && m.Password != "" {
+			req.SetBasicAuth(m.Login, m.Password)
+		}
+	case f.Username != "":
+		req.SetBasicAuth(f.Username, f.Token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+f.Token)
+	}
+	return nil
+}
+
+// setGitLabAuth uses the PRIVATE-TOKEN header with the repo token or GITLAB_TOKEN.
+func setGitLabAuth(req *http.Request, r Repo) {
+	t := r.token()
+	if t == "" {
+		t = os.Getenv("GITLAB_TOKEN")
+	}
+	if t != "" {
+		req.Header.Set("PRIVATE-TOKEN", t)
+	}
+}
+
+// setBitbucketAuth uses basic auth with BITBUCKET_USERNAME and an app password,
+// taken from the repo token or BITBUCKET_APP_PASSWORD.
+func setBitbucketAuth(req *http.Request, r Repo) {
+	user := os.Getenv("BITBUCKET_USERNAME")
+	password := r.token()
+	if password == "" {
+		password = os.Getenv("BITBUCKET_APP_PASSWORD")
+	}
+	if user != "" && password != "" {
+		req.SetBasicAuth(user, password)
+	}
+}
+
+// token returns the repo's own credential, if any. The value must never be logged.
+func (r Repo) token() string {
+	if r.Token != "" {
+		return r.Token
+	}
+	if r.TokenEnv != "" {
+		return os.Getenv(r.TokenEnv)
+	}
+	return ""
+}
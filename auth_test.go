@@ -0,0 +1,60 @@
+package oam
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunSendsRepoHeaders(t *testing.T) {
+	var mu sync.Mutex
+	headers := map[string]http.Header{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		headers[strings.Split(req.URL.Path, "/")[2]] = req.Header.Clone()
+		mu.Unlock()
+		io.WriteString(w, testSpec)
+	}))
+	defer srv.Close()
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"plain": {URL: "o/plain", Version: "main", Path: Paths{"openapi.yaml"}, Headers: map[string]string{
+			"X-Api-Key": "key",
+			"X-Tenant":  "acme",
+		}},
+		"override": {URL: "o/override", Version: "main", Path: Paths{"openapi.yaml"}, Headers: map[string]string{
+			"Authorization": "ApiKey secret",
+			"User-Agent":    "gateway-client",
+		}},
+	})
+	f := testFetcher()
+	f.Token = "token"
+	f.UserAgent = "oam-test"
+	if _, err := f.Run(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		repo, header, want string
+	}{
+		{"plain", "X-Api-Key", "key"},
+		{"plain", "X-Tenant", "acme"},
+		{"plain", "Authorization", "Bearer token"},
+		{"plain", "User-Agent", "oam-test"},
+		{"override", "Authorization", "ApiKey secret"},
+		{"override", "User-Agent", "gateway-client"},
+	}
+	for _, tt := range tests {
+		h, ok := headers[tt.repo]
+		if !ok {
+			t.Fatalf("no request for %s", tt.repo)
+		}
+		if got := h.Get(tt.header); got != tt.want {
+			t.Errorf("%s: %s = %q, want %q", tt.repo, tt.header, got, tt.want)
+		}
+	}
+}
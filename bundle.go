@@ -0,0 +1,295 @@
+package oam
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// bundler inlines the files referenced by a spec into its components section.
+//
+// A reference to file#/components/<section>/<name> keeps its section and
+// name. Any other reference becomes a schema named after the last segment of
+// its JSON pointer, or the file's base name when there is no pointer. When a
+// name is already taken, a numeric suffix is appended: User, User_2, User_3.
+// Names are assigned in document order, so the output is deterministic.
+//
+// With schemasOnly just the references to schemas are inlined, all into
+// components/schemas. Others are kept, relative to the spec.
+type bundler struct {
+	r           *run
+	t           target
+	schemasOnly bool
+	docs        map[string]yaml.MapSlice // Parsed referenced files, by repo path.
+	refs        map[string]string        // Internal ref for each file#pointer.
+	taken       map[string]bool          // Used component names, as section/name.
+	added       []component              // Components to insert, in order.
+}
+
+type component struct {
+	section, name string
+	value         interface{}
+}
+
+// bundle returns the spec with every external $ref inlined, or with
+// schemasOnly every external $ref to a schema.
+func (r *run) bundle(t target, data []byte, schemasOnly bool) ([]byte, error) {
+	var root yaml.MapSlice
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+
+	b := &bundler{r: r, t: t, schemasOnly: schemasOnly, docs: map[string]yaml.MapSlice{}, refs: map[string]string{}, taken: map[string]bool{}}
+	components, _ := mapGet(root, "components").(yaml.MapSlice)
+	for _, sec := range components {
+		names, _ := sec.Value.(yaml.MapSlice)
+		for _, n := range names {
+			b.taken[fmt.Sprint(sec.Key)+"/"+fmt.Sprint(n.Key)] = true
+		}
+	}
+
+	if _, err := b.walk(root, t.Path); err != nil {
+		return nil, err
+	}
+
+	for _, c := range b.added {
+		sec, _ := mapGet(components, c.section).(yaml.MapSlice)
+		sec = append(sec, yaml.MapItem{Key: c.name, Value: c.value})
+		components = mapSet(components, c.section, sec)
+	}
+	if len(b.added) > 0 {
+		root = mapSet(root, "components", components)
+	}
+	return yaml.Marshal(root)
+}
+
+// walk rewrites the $refs in v, which was read from file, in place.
+func (b *bundler) walk(v interface{}, file string) (interface{}, error) {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for i, item := range v {
+			if ref, ok := item.Value.(string); ok && item.Key == "$ref" {
+				internal, err := b.ref(ref, file)
+				if err != nil {
+					return nil, err
+				}
+				v[i].Value = internal
+				continue
+			}
+			val, err := b.walk(item.Value, file)
+			if err != nil {
+				return nil, err
+			}
+			v[i].Value = val
+		}
+	case []interface{}:
+		for i, item := range v {
+			val, err := b.walk(item, file)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = val
+		}
+	}
+	return v, nil
+}
+
+// ref returns the internal ref replacing ref found in file, inlining the
+// referenced value as a new component on first use.
+func (b *bundler) ref(ref, file string) (string, error) {
+	target, pointer, _ := strings.Cut(ref, "#")
+	switch {
+	case strings.Contains(target, "://"):
+		return ref, nil
+	case target == "":
+		target = file
+	default:
+		target = path.Join(path.Dir(file), target)
+	}
+	if target == b.t.Path {
+		return "#" + pointer, nil
+	}
+
+	if b.schemasOnly && !isSchemaPointer(pointer) {
+		rel, err := relPath(path.Dir(b.t.Path), target)
+		if err != nil {
+			return "", err
+		}
+		if pointer != "" {
+			rel += "#" + pointer
+		}
+		return rel, nil
+	}
+
+	key := target + "#" + pointer
+	if internal, ok := b.refs[key]; ok {
+		return internal, nil
+	}
+
+	doc, err := b.load(target)
+	if err != nil {
+		return "", err
+	}
+	val, err := resolvePointer(doc, pointer)
+	if err != nil {
+		return "", fmt.Errorf("%s in %s: %w", ref, file, err)
+	}
+
+	section, name := componentName(target, pointer)
+	if b.schemasOnly {
+		section = "schemas"
+	}
+	if unique := b.unique(section, name); unique != name {
+		b.r.logger().Warn("component name taken, renaming", "repo", b.t.Name, "path", b.t.Path, "ref", key, "component", section+"/"+name, "as", unique)
+		name = unique
+	}
+	internal := "#/components/" + section + "/" + name
+	b.refs[key] = internal
+
+	i := len(b.added)
+	b.added = append(b.added, component{section: section, name: name})
+	if b.added[i].value, err = b.walk(deepCopy(val), target); err != nil {
+		return "", err
+	}
+	return internal, nil
+}
+
+func (b *bundler) load(file string) (yaml.MapSlice, error) {
+	if doc, ok := b.docs[file]; ok {
+		return doc, nil
+	}
+	src, err := b.r.f.download(b.r.ctx, b.t.Name, b.t.Repo, file, false)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(src.Data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	b.docs[file] = doc
+	return doc, nil
+}
+
+func (b *bundler) unique(section, name string) string {
+	candidate := name
+	for i := 2; b.taken[section+"/"+candidate]; i++ {
+		candidate = name + "_" + strconv.Itoa(i)
+	}
+	b.taken[section+"/"+candidate] = true
+	return candidate
+}
+
+var invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// componentName derives the section and name of the component for file#pointer.
+func componentName(file, pointer string) (string, string) {
+	segs := pointerSegments(pointer)
+	if len(segs) == 3 && segs[0] == "components" {
+		return segs[1], invalidComponentChars.ReplaceAllString(segs[2], "_")
+	}
+
+	name := trimExt(path.Base(file))
+	if len(segs) > 0 {
+		name = segs[len(segs)-1]
+	}
+	return "schemas", invalidComponentChars.ReplaceAllString(name, "_")
+}
+
+// isSchemaPointer reports whether a JSON pointer into a referenced file points
+// at a schema: the whole file, or anything but paths, Swagger 2.0 parameters
+// and responses, and components other than schemas.
+func isSchemaPointer(pointer string) bool {
+	segs := pointerSegments(pointer)
+	if len(segs) == 0 {
+		return true
+	}
+	switch segs[0] {
+	case "paths", "parameters", "responses", "securityDefinitions":
+		return false
+	case "components":
+		return len(segs) > 1 && segs[1] == "schemas"
+	}
+	return true
+}
+
+func pointerSegments(pointer string) []string {
+	pointer = strings.TrimPrefix(pointer, "/")
+	if pointer == "" {
+		return nil
+	}
+	segs := strings.Split(pointer, "/")
+	for i, s := range segs {
+		segs[i] = strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+	}
+	return segs
+}
+
+// resolvePointer returns the value at a JSON pointer in doc.
+func resolvePointer(doc interface{}, pointer string) (interface{}, error) {
+	v := doc
+	for _, seg := range pointerSegments(pointer) {
+		switch node := v.(type) {
+		case yaml.MapSlice:
+			var ok bool
+			if v, ok = mapLookup(node, seg); !ok {
+				return nil, fmt.Errorf("no %q in JSON pointer %s", seg, pointer)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("invalid index %q in JSON pointer %s", seg, pointer)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("cannot resolve JSON pointer %s", pointer)
+		}
+	}
+	return v, nil
+}
+
+func mapLookup(ms yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range ms {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func mapGet(ms yaml.MapSlice, key string) interface{} {
+	v, _ := mapLookup(ms, key)
+	return v
+}
+
+// mapSet replaces the value of key, or appends it, and returns the map.
+func mapSet(ms yaml.MapSlice, key string, val interface{}) yaml.MapSlice {
+	for i, item := range ms {
+		if fmt.Sprint(item.Key) == key {
+			ms[i].Value = val
+			return ms
+		}
+	}
+	return append(ms, yaml.MapItem{Key: key, Value: val})
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		c := make(yaml.MapSlice, len(v))
+		for i, item := range v {
+			c[i] = yaml.MapItem{Key: item.Key, Value: deepCopy(item.Value)}
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = deepCopy(item)
+		}
+		return c
+	}
+	return v
+}
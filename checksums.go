@@ -0,0 +1,32 @@
+package oam
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WriteChecksums writes checksums.txt to the output directory in sha256sum
+// format, so the output can be checked with `sha256sum -c checksums.txt` from
+// that directory. Files that failed are left out.
+func (r *Result) WriteChecksums() error {
+	written := map[string]string{}
+	for _, f := range r.Files {
+		if f.Err == nil {
+			written[f.Output] = f.SHA256
+		}
+	}
+
+	paths := make([]string, 0, len(written))
+	for p := range written {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", written[p], p)
+	}
+	return writeAtomic(filepath.Join(r.OutputDir, "checksums.txt"), []byte(b.String()), 0644)
+}
@@ -0,0 +1,89 @@
+package oam
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Clean removes the files the lock records as written under outputDir, and
+// any directories left empty by that, returning the removed files. Other
+// files are left alone. With dryRun nothing is removed. The lock's repos keep
+// their pinned commits but no longer list files. An empty outputDir is the
+// default, ./oam, as for Run and Verify.
+func Clean(outputDir string, lock *Lock, dryRun bool) ([]string, error) {
+	root, err := cleanRoot(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range lock.Repos {
+		for _, f := range entry.Files {
+			rel := filepath.FromSlash(f.Output)
+			if !filepath.IsLocal(rel) {
+				return nil, fmt.Errorf("lock lists %s outside the output directory", f.Output)
+			}
+			files = append(files, rel)
+		}
+	}
+	sort.Strings(files)
+
+	var removed []string
+	for _, rel := range files {
+		file := filepath.Join(root, rel)
+		if _, err := os.Lstat(file); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		removed = append(removed, file)
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return removed, err
+		}
+		removeEmptyDirs(root, filepath.Dir(rel))
+	}
+
+	if !dryRun {
+		for name, entry := range lock.Repos {
+			entry.Files = nil
+			lock.Repos[name] = entry
+		}
+	}
+	return removed, nil
+}
+
+// cleanRoot returns the output directory, defaulting an unset one, and
+// refusing a blank one or one whose removal would be catastrophic.
+func cleanRoot(outputDir string) (string, error) {
+	if outputDir == "" {
+		outputDir = DefaultOutputDir
+	}
+	if strings.TrimSpace(outputDir) == "" {
+		return "", fmt.Errorf("refusing to clean the blank output directory %q", outputDir)
+	}
+	abs, err := filepath.Abs(outputDir)
+	if err != nil {
+		return "", err
+	}
+	if abs == filepath.VolumeName(abs)+string(filepath.Separator) {
+		return "", fmt.Errorf("refusing to clean %s", abs)
+	}
+	return filepath.Clean(outputDir), nil
+}
+
+// removeEmptyDirs removes dir, relative to root, and its parents while they
+// are empty.
+func removeEmptyDirs(root, dir string) {
+	for ; dir != "."; dir = filepath.Dir(dir) {
+		// Remove fails on a directory that isn't empty.
+		if os.Remove(filepath.Join(root, dir)) != nil {
+			return
+		}
+	}
+}
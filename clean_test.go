@@ -0,0 +1,56 @@
+package oam
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanDefaultsOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	file := filepath.Join(DefaultOutputDir, "pets", "openapi.yaml")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(testSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lock := Lock{Repos: map[string]LockedRepo{
+		"pets": {URL: "o/r", Version: "main", Files: []LockedFile{{Path: "openapi.yaml", Output: "pets/openapi.yaml"}}},
+	}}
+
+	// An unset output_dir is where Run wrote the files.
+	removed, err := Clean("", &lock, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != filepath.Clean(file) {
+		t.Errorf("removed %v, want %s", removed, file)
+	}
+	if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%s still exists: %v", file, err)
+	}
+	if len(lock.Repos["pets"].Files) != 0 {
+		t.Errorf("lock still lists %v", lock.Repos["pets"].Files)
+	}
+}
+
+func TestCleanRefusesDangerousOutputDirs(t *testing.T) {
+	for _, dir := range []string{" ", "/"} {
+		lock := Lock{Repos: map[string]LockedRepo{}}
+		if _, err := Clean(dir, &lock, true); err == nil {
+			t.Errorf("Clean(%q) succeeded", dir)
+		}
+	}
+}
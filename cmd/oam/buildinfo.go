@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set with -ldflags "-X main.version=... -X main.commit=... -X main.date=...".
+// Empty values are filled in from the build info Go embeds in the binary.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// buildInfo describes this build of oam for -version.
+func buildInfo() string {
+	v, c, d := versionInfo()
+	return fmt.Sprintf("oam %s (commit %s, built %s, %s %s/%s)", v, c, d, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// userAgent is the default User-Agent, e.g. oam/v1.2.0.
+func userAgent() string {
+	v, _, _ := versionInfo()
+	return "oam/" + strings.Trim(v, "()")
+}
+
+// versionInfo returns the version, commit and build date, each "unknown" or
+// "(devel)" when not known.
+func versionInfo() (string, string, string) {
+	v, c, d := version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" {
+			v = info.Main.Version
+		}
+		dirty := false
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if c == "" {
+					c = s.Value
+				}
+			case "vcs.time":
+				if d == "" {
+					d = s.Value
+				}
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+		if dirty && commit == "" && c != "" {
+			c += "-dirty"
+		}
+	}
+	if v == "" {
+		v = "(devel)"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return v, c, d
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/ogugu9/oam"
+)
+
+// runClean implements `oam clean`, removing the files recorded in the lock.
+func runClean(args []string) error {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	c := addConfigFlags(flags)
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "print what would be removed without removing it")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: oam clean [flags]\n\nRemove the files oam wrote, as recorded in the lock file, leaving other files\nin the output directory alone.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	config, lock, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	removed, err := oam.Clean(config.OutputDir, &lock, dryRun)
+	for _, file := range removed {
+		if dryRun {
+			fmt.Printf("would remove %s\n", file)
+		} else {
+			fmt.Printf("removed %s\n", file)
+		}
+	}
+	if err != nil || dryRun {
+		return err
+	}
+	return oam.WriteLock(c.lockPath, lock)
+}
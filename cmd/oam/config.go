@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+
+	"github.com/ogugu9/oam"
+)
+
+// configFlags are the flags of the subcommands that read the config and the
+// lock without fetching.
+type configFlags struct {
+	configPath    string
+	lockPath      string
+	outputDir     string
+	allowUnsetEnv bool
+}
+
+// addConfigFlags registers the -config, -lock, -output-dir and
+// -allow-unset-env flags on flags.
+func addConfigFlags(flags *flag.FlagSet) *configFlags {
+	c := &configFlags{}
+	flags.StringVar(&c.configPath, "config", "oam.yaml", "path to the config file")
+	flags.StringVar(&c.configPath, "c", "oam.yaml", "path to the config file (shorthand)")
+	flags.StringVar(&c.lockPath, "lock", "", "path to the lock file (default oam.lock next to the config)")
+	flags.StringVar(&c.outputDir, "output-dir", "", "override output_dir from the config")
+	flags.BoolVar(&c.allowUnsetEnv, "allow-unset-env", false, "expand unset ${VAR} references in the config to an empty string instead of failing")
+	return c
+}
+
+// load reads the config, with environment variables expanded, the output
+// directory overridden or defaulted, and the lock, as a fetch would. It sets
+// c.lockPath to the lock file read.
+func (c *configFlags) load() (oam.Config, oam.Lock, error) {
+	config, err := oam.ReadConfig(c.configPath)
+	if err != nil {
+		return config, oam.Lock{}, err
+	}
+	if config, err = config.ExpandEnv(c.allowUnsetEnv); err != nil {
+		return config, oam.Lock{}, err
+	}
+	if c.outputDir != "" {
+		config.OutputDir = c.outputDir
+	}
+	if config.OutputDir == "" {
+		config.OutputDir = oam.DefaultOutputDir
+	}
+	if c.lockPath == "" {
+		c.lockPath = defaultLockPath(c.configPath)
+	}
+	lock, err := oam.ReadLock(c.lockPath)
+	return config, lock, err
+}
+
+// defaultLockPath returns the lock file next to the config at configPath, or
+// in the current directory for a config read from stdin.
+func defaultLockPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "oam.lock")
+}
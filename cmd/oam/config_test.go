@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ogugu9/oam"
+)
+
+func TestConfigFlagsLoad(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "oam.yaml")
+	if err := os.WriteFile(configPath, []byte("repos: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args      []string
+		outputDir string
+	}{
+		{[]string{"-config", configPath}, oam.DefaultOutputDir},
+		{[]string{"-config", configPath, "-output-dir", "specs"}, "specs"},
+	} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		c := addConfigFlags(flags)
+		if err := flags.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		config, _, err := c.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.OutputDir != tt.outputDir {
+			t.Errorf("%v: output dir %q, want %q", tt.args, config.OutputDir, tt.outputDir)
+		}
+		if want := filepath.Join(dir, "oam.lock"); c.lockPath != want {
+			t.Errorf("%v: lock %q, want %q", tt.args, c.lockPath, want)
+		}
+	}
+}
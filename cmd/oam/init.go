@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+const starterConfig = `# Directory the specs are written to, one subdirectory per repo.
+output_dir: ./oam
+
+repos:
+  # The key is an alias naming the output directory and file:
+  # ./oam/petstore/petstore.yaml. It needn't match the repo, so one repo can be
+  # listed under several aliases, e.g. at two versions.
+  petstore:
+    # GitHub repository as owner/name.
+    url: swagger-api/swagger-petstore
+    # Branch, tag or commit. "latest" picks the newest release, and a semver
+    # constraint such as "^1.2" the highest matching tag.
+    version: master
+    # Optionally say what version names: branch, tag or commit.
+    # ref_type: branch
+    # Path of the spec in the repo. A list, a directory or a glob such as
+    # specs/**/*.yaml fetches several files.
+    path: src/main/resources/openapi.yaml
+    # For private repos, set GITHUB_TOKEN or name a variable holding a token:
+    # token_env: PETSTORE_TOKEN
+`
+
+// runInit implements `oam init`, writing a starter config.
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	var configPath string
+	var force bool
+	flags.StringVar(&configPath, "config", "oam.yaml", "path of the config file to write")
+	flags.StringVar(&configPath, "c", "oam.yaml", "path of the config file to write (shorthand)")
+	flags.BoolVar(&force, "force", false, "overwrite an existing config file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: oam init [flags]\n\nWrite a commented starter config.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(configPath, mode, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", configPath)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(starterConfig); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", configPath)
+	return nil
+}
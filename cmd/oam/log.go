@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// setupLogger configures the default slog logger to write to stderr.
+func setupLogger(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	return nil
+}
+
+// fatal logs err and exits with status 1.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
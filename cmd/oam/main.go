@@ -0,0 +1,503 @@
+// Command oam fetches the OpenAPI specs listed in a config file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ogugu9/oam"
+)
+
+// exitCancelled is the exit status after SIGINT or SIGTERM, as shells report
+// for a process killed by SIGINT.
+const exitCancelled = 130
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		setupLogger("info", "text")
+		if err := runInit(os.Args[2:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "clean" {
+		setupLogger("info", "text")
+		if err := runClean(os.Args[2:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		setupLogger("info", "text")
+		if err := runVerify(os.Args[2:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		setupLogger("info", "text")
+		if err := runStatus(os.Args[2:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	var o options
+	var tokenFile, appKey, caFile, retryOn, proxy, outputTemplate, stripPrefixes, contentTypes, credential string
+	var only, skip string
+	var appID, installationID int64
+	var logLevel, logFormat string
+	var noCache, noNetrc, stripExtensions, lintSpecs, showVersion, watch bool
+	f := &oam.Fetcher{}
+	flag.StringVar(&o.configPath, "config", "oam.yaml", "path to the config file, or - to read it from stdin")
+	flag.StringVar(&o.configPath, "c", "oam.yaml", "path to the config file, or - to read it from stdin (shorthand)")
+	flag.BoolVar(&o.allowUnsetEnv, "allow-unset-env", false, "expand unset ${VAR} references in the config to an empty string instead of failing")
+	flag.StringVar(&o.outputDir, "output-dir", "", "override output_dir from the config")
+	flag.StringVar(&o.baseURL, "base-url", "", "override base_url from the config, e.g. for GitHub Enterprise")
+	flag.StringVar(&credential, "credential", "env", "where to find the GitHub token: env for GITHUB_TOKEN and -token-file, or keyring to fall back to the OS keyring's oam/github-token secret when neither is set")
+	flag.StringVar(&tokenFile, "token-file", "", "read the GitHub token from a file (overrides GITHUB_TOKEN_FILE)")
+	flag.Int64Var(&appID, "github-app-id", 0, "authenticate as this GitHub App, with -github-app-installation-id and -github-app-key")
+	flag.Int64Var(&installationID, "github-app-installation-id", 0, "installation of the GitHub App to request tokens for")
+	flag.StringVar(&appKey, "github-app-key", "", "path to the GitHub App's private key in PEM form")
+	flag.BoolVar(&noNetrc, "no-netrc", false, "don't read credentials from .netrc ($NETRC or ~/.netrc)")
+	flag.DurationVar(&f.Timeout, "timeout", 60*time.Second, "timeout for each HTTP request")
+	flag.DurationVar(&o.deadline, "deadline", 0, "abandon the run after this long, e.g. 5m, exiting non-zero (default no limit)")
+	flag.StringVar(&caFile, "ca-file", "", "PEM file of CA certificates to trust in addition to the system's, e.g. an internal CA")
+	flag.BoolVar(&f.Insecure, "insecure", false, "skip TLS certificate verification for every repo; anyone on the network path can then tamper with the specs")
+	flag.StringVar(&proxy, "proxy", "", "proxy URL for all requests, overriding HTTP_PROXY and HTTPS_PROXY; NO_PROXY still applies")
+	flag.StringVar(&f.UserAgent, "user-agent", userAgent(), "User-Agent header sent with every request")
+	flag.IntVar(&f.MaxIdleConnsPerHost, "max-idle-conns-per-host", 20, "idle connections kept open to each host for reuse")
+	flag.DurationVar(&f.IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "how long idle connections are kept open")
+	flag.DurationVar(&f.KeepAlive, "keep-alive", 30*time.Second, "interval of TCP keep-alive probes; negative disables them")
+	flag.IntVar(&f.Retries, "retries", 3, "number of retries for failed requests")
+	flag.StringVar(&retryOn, "retry-on", "429,5xx", "comma-separated HTTP statuses to retry, where 5xx stands for 500 to 599; 404 is never retried")
+	flag.DurationVar(&f.RetryDelay, "retry-delay", time.Second, "base delay between retries, doubled on each attempt")
+	flag.StringVar(&f.CacheDir, "cache-dir", oam.DefaultCacheDir(), "directory of the on-disk cache")
+	flag.BoolVar(&noCache, "no-cache", false, "disable the on-disk cache")
+	flag.BoolVar(&f.Offline, "offline", false, "never use the network, serving every file from the on-disk cache; with the lock file this repeats a previous run")
+	flag.BoolVar(&f.SkipValidation, "skip-validation", false, "write fetched files without checking they are OpenAPI specs")
+	flag.StringVar(&contentTypes, "allow-content-type", strings.Join(oam.DefaultContentTypes, ","), "comma-separated media types accepted in responses, such as text/plain, text/* or */*; others, like an HTML login page, fail")
+	flag.BoolVar(&f.ValidateSchema, "validate-schema", false, "check each OpenAPI 3.0 or 3.1 spec against its JSON Schema, not writing specs that don't match")
+	flag.StringVar(&f.Format, "format", "", "output format: yaml or json (default the fetched spec's, with a matching extension)")
+	flag.StringVar(&outputTemplate, "output-template", "", "template for output file names relative to the output directory, with {{.RepoName}}, {{.Version}}, {{.Path}}, {{.Base}}, {{.Name}} and {{.Ext}} (default {{.RepoName}}/{{.Name}}.{{.Ext}})")
+	flag.BoolVar(&f.PreservePaths, "preserve-paths", false, "write each file at its path in the repo under the repo's directory")
+	flag.BoolVar(&stripExtensions, "strip-extensions", false, "remove vendor extensions (x- keys) from specs")
+	flag.StringVar(&stripPrefixes, "strip-extension-prefixes", "", "remove only the vendor extensions with these comma-separated prefixes, e.g. x-internal-,x-amazon-")
+	flag.Int64Var(&f.MaxSize, "max-size", 0, "fail files larger than this many bytes as sent, without reading past the limit (default no limit)")
+	flag.BoolVar(&f.Preflight, "preflight", false, "send a HEAD request before each download, failing missing files and those over -max-size before the GET")
+	flag.Int64Var(&f.MaxArchiveSize, "max-archive-size", 256<<20, "maximum total size in bytes of the files extracted from an archive")
+	flag.BoolVar(&lintSpecs, "lint", false, "warn about operations without an operationId, responses without a description and unused components")
+	flag.BoolVar(&f.LintError, "lint-error", false, "like -lint, but fail specs with lint problems")
+	flag.BoolVar(&f.FollowRefs, "follow-refs", false, "also download files referenced by relative $refs")
+	flag.IntVar(&f.RefDepth, "ref-depth", 10, "maximum depth of nested $ref files with -follow-refs")
+	flag.BoolVar(&f.BundleComponents, "bundle-components", false, "move the schema files and schemas that external $refs point at into components/schemas, renaming same-named ones with numeric suffixes, and point the $refs at them; other $refs are kept, for -follow-refs")
+	flag.BoolVar(&f.Bundle, "bundle", false, "inline external $refs into components, such as schema files into components/schemas, and point the $refs at them, writing one self-contained file")
+	flag.BoolVar(&o.dryRun, "dry-run", false, "print what would be fetched and written without doing it")
+	flag.BoolVar(&o.checkURLs, "check-urls", false, "with -dry-run, send a HEAD request to each URL instead, printing which answer 200 or 304 and exiting non-zero if any don't")
+	flag.BoolVar(&o.checksums, "checksums", false, "write checksums.txt listing every written file to the output directory")
+	flag.StringVar(&o.mergePath, "merge", "", "after fetching, combine the OpenAPI 3 specs into a single spec at this path, as JSON if it ends in .json; component names, operationIds and conflicting tags are prefixed with the repo name")
+	flag.BoolVar(&o.mergeStrict, "merge-strict", false, "with -merge, keep component, security scheme, tag and operationId names as they are, failing with a report of every name two specs define differently")
+	flag.BoolVar(&o.timing, "timing", false, "print how long each file took to download and the total at the end")
+	flag.StringVar(&o.summary, "output-summary", "", "print a summary of the run to stdout at the end; json is the only format, and sends diffs to stderr")
+	flag.StringVar(&o.manifestPath, "manifest", "", "write a JSON summary of every file fetched to this path")
+	flag.BoolVar(&f.Diff, "diff", false, "print a diff against existing files before overwriting them")
+	flag.BoolVar(&f.FormatYAML, "format-yaml", false, "re-encode YAML specs with consistent indentation and quoting, dropping comments and expanding aliases")
+	flag.BoolVar(&f.SortKeys, "sort-keys", false, "like -format-yaml, but also sort the keys of every mapping")
+	flag.BoolVar(&f.AlwaysWrite, "always-write", false, "rewrite files even when their contents are unchanged, updating their modification times")
+	flag.BoolVar(&o.noHooks, "no-hooks", false, "don't run the hooks from the config")
+	flag.DurationVar(&f.HookTimeout, "hook-timeout", time.Minute, "timeout for each hook command")
+	flag.BoolVar(&f.Ordered, "ordered", false, "log each repo's messages together once it has finished, in repo name order, so runs log the same way each time")
+	flag.BoolVar(&f.FailFast, "fail-fast", false, "stop at the first failure instead of fetching everything possible")
+	flag.StringVar(&o.lockPath, "lock", "", "path to the lock file (default oam.lock next to the config, or in the current directory with -config -)")
+	flag.BoolVar(&f.Update, "update", false, "re-resolve versions and rewrite the lock file")
+	flag.BoolVar(&f.OnlyChanged, "only-changed", false, "skip repos whose url, version and path are unchanged since the last run and whose files are still on disk")
+	flag.BoolVar(&f.Force, "force", false, "download and rewrite every file, bypassing the in-memory and on-disk caches, -only-changed and the unchanged-file check; rate limits and concurrency still apply")
+	flag.IntVar(&o.concurrency, "concurrency", 0, "maximum number of parallel requests (default 20), halved on each burst of rate-limit responses and slowly restored; very high values risk GitHub secondary rate limits")
+	flag.DurationVar(&f.CacheTTL, "cache-ttl", 0, "serve files from the on-disk cache without revalidating them for this long after they were downloaded or last revalidated, e.g. 1h")
+	flag.Int64Var(&f.CacheMaxBytes, "cache-max-bytes", 256<<20, "maximum total size of the files kept in memory for reuse within and between runs, evicting the least recently used")
+	flag.IntVar(&f.MaxPerHost, "max-per-host", 8, "maximum number of parallel requests to any one host, within -concurrency")
+	flag.IntVar(&f.MinConcurrency, "min-concurrency", 1, "fewest parallel requests that rate limits reduce -concurrency to")
+	flag.StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", "text", "log format: text or json")
+	flag.StringVar(&only, "only", "", "fetch only the repos with these comma-separated names or glob patterns, e.g. pet,billing-*")
+	flag.StringVar(&skip, "skip", "", "don't fetch the repos with these comma-separated names or glob patterns")
+	flag.BoolVar(&watch, "watch", false, "fetch again whenever the config file changes, until interrupted")
+	flag.BoolVar(&showVersion, "version", false, "print version and build information and exit")
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(buildInfo())
+		return
+	}
+
+	if err := setupLogger(logLevel, logFormat); err != nil {
+		fatal(err)
+	}
+
+	switch o.summary {
+	case "":
+	case "json":
+		// Keep stdout for the summary alone.
+		f.DiffOutput = os.Stderr
+	default:
+		fatal(fmt.Errorf("invalid summary format %q", o.summary))
+	}
+
+	if o.checkURLs && !o.dryRun {
+		fatal(errors.New("-check-urls needs -dry-run"))
+	}
+	if o.mergeStrict && o.mergePath == "" {
+		fatal(errors.New("-merge-strict needs -merge"))
+	}
+	if f.Force && f.Offline {
+		fatal(errors.New("-force always downloads, so cannot be used with -offline"))
+	}
+	if noCache {
+		if f.Offline {
+			fatal(errors.New("-offline needs the on-disk cache, so cannot be used with -no-cache"))
+		}
+		f.CacheDir = ""
+	}
+
+	if outputTemplate != "" {
+		tmpl, err := oam.ParseOutputTemplate(outputTemplate)
+		if err != nil {
+			fatal(err)
+		}
+		f.OutputTemplate = tmpl
+	}
+
+	if stripPrefixes != "" {
+		for _, p := range strings.Split(stripPrefixes, ",") {
+			if !strings.HasPrefix(p, "x-") {
+				fatal(fmt.Errorf("extension prefix %q does not start with x-", p))
+			}
+			f.StripExtensions = append(f.StripExtensions, p)
+		}
+	} else if stripExtensions {
+		f.StripExtensions = oam.Extensions{"x-"}
+	}
+
+	f.AllowContentTypes = []string{}
+	for _, t := range strings.Split(contentTypes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			f.AllowContentTypes = append(f.AllowContentTypes, t)
+		}
+	}
+
+	f.Only, f.Skip = splitList(only), splitList(skip)
+
+	if lintSpecs || f.LintError {
+		f.Lint = oam.DefaultLintRules()
+	}
+	if f.SortKeys {
+		f.FormatYAML = true
+	}
+
+	statuses, err := parseStatuses(retryOn)
+	if err != nil {
+		fatal(fmt.Errorf("invalid -retry-on: %w", err))
+	}
+	f.RetryOn = statuses
+
+	if caFile != "" {
+		pool, err := oam.LoadCAFile(caFile)
+		if err != nil {
+			fatal(err)
+		}
+		f.RootCAs = pool
+	}
+
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			fatal(fmt.Errorf("invalid proxy URL %q", proxy))
+		}
+		f.Proxy = u
+	}
+
+	f.Username, f.Token, err = oam.CredentialsFromEnv(tokenFile)
+	if err != nil {
+		fatal(err)
+	}
+	switch credential {
+	case "env":
+	case "keyring":
+		if f.Token == "" {
+			if f.Token, err = oam.KeyringSecret("oam", "github-token"); errors.Is(err, oam.ErrNoKeyring) {
+				fatal(fmt.Errorf("-credential keyring: %w; set GITHUB_TOKEN or use -token-file instead", err))
+			} else if err != nil {
+				fatal(fmt.Errorf("-credential keyring: %w", err))
+			}
+		}
+	default:
+		fatal(fmt.Errorf("invalid -credential %q, want env or keyring", credential))
+	}
+	if appID != 0 || installationID != 0 || appKey != "" {
+		if appID == 0 || installationID == 0 || appKey == "" {
+			fatal(errors.New("-github-app-id, -github-app-installation-id and -github-app-key must be used together"))
+		}
+		data, err := os.ReadFile(appKey)
+		if err != nil {
+			fatal(fmt.Errorf("failed to read GitHub App key: %w", err))
+		}
+		key, err := oam.ParseGitHubAppKey(data)
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", appKey, err))
+		}
+		f.App = &oam.GitHubApp{AppID: appID, InstallationID: installationID, PrivateKey: key}
+	}
+	if !noNetrc {
+		if f.Netrc, err = oam.ReadNetrc(oam.DefaultNetrcPath()); err != nil {
+			fatal(fmt.Errorf("failed to read netrc: %w", err))
+		}
+	}
+
+	if o.lockPath == "" {
+		o.lockPath = defaultLockPath(o.configPath)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if watch {
+		if err := watchConfig(ctx, f, o); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	err = fetchOnce(ctx, f, o)
+	if errors.Is(err, context.Canceled) {
+		slog.Error("run cancelled, exiting", "err", err)
+		os.Exit(exitCancelled)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// options are the flags that apply to each run.
+type options struct {
+	configPath    string
+	lockPath      string
+	outputDir     string
+	baseURL       string
+	manifestPath  string
+	mergePath     string
+	mergeStrict   bool
+	summary       string
+	concurrency   int
+	deadline      time.Duration
+	allowUnsetEnv bool
+	noHooks       bool
+	dryRun        bool
+	checkURLs     bool
+	checksums     bool
+	timing        bool
+}
+
+// fetchOnce reads the config and lock, fetches everything and writes the lock
+// and any requested reports.
+func fetchOnce(ctx context.Context, f *oam.Fetcher, o options) error {
+	config, err := oam.ReadConfig(o.configPath)
+	if err != nil {
+		return err
+	}
+	config, err = config.ExpandEnv(o.allowUnsetEnv)
+	if err != nil {
+		return err
+	}
+
+	// Precedence: flag > config value > default.
+	if o.baseURL != "" {
+		config.BaseURL = o.baseURL
+	}
+	if o.outputDir != "" {
+		config.OutputDir = o.outputDir
+	}
+	if o.concurrency != 0 {
+		config.Concurrency = o.concurrency
+	}
+	if o.noHooks {
+		config.Hooks = oam.Hooks{}
+	}
+	if f.App != nil {
+		// Mint tokens from the API the repos use.
+		f.App.APIURL = config.APIURL
+	}
+
+	f.Lock, err = oam.ReadLock(o.lockPath)
+	if err != nil {
+		return err
+	}
+
+	if o.dryRun && o.checkURLs {
+		plan, err := f.PlanReachable(ctx, config)
+		if err != nil {
+			return err
+		}
+		return printReachable(os.Stdout, plan)
+	}
+	if o.dryRun {
+		plan, err := f.Plan(config)
+		if err != nil {
+			return err
+		}
+		printPlan(plan)
+		return nil
+	}
+
+	if o.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.deadline)
+		defer cancel()
+	}
+
+	result, err := f.Run(ctx, config)
+	if result == nil {
+		return err
+	}
+
+	if o.timing {
+		printTiming(os.Stderr, result)
+	}
+	if o.summary != "" {
+		if err := result.WriteSummary(os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	// So that verify doesn't report them as extra files.
+	for _, file := range []string{o.lockPath, o.manifestPath, o.mergePath} {
+		if file != "" {
+			result.Lock.AddGenerated(config.OutputDir, file)
+		}
+	}
+	if err := oam.WriteLock(o.lockPath, result.Lock); err != nil {
+		return err
+	}
+
+	if o.checksums {
+		if err := result.WriteChecksums(); err != nil {
+			return err
+		}
+	}
+
+	if o.manifestPath != "" {
+		if err := result.WriteManifest(o.manifestPath); err != nil {
+			return err
+		}
+	}
+
+	// A merge of only some of the specs would silently lack the others.
+	if o.mergePath != "" && err == nil {
+		write := result.WriteMerged
+		if o.mergeStrict {
+			write = result.WriteMergedStrict
+		}
+		if err := write(o.mergePath); err != nil {
+			return fmt.Errorf("failed to merge specs: %w", err)
+		}
+		slog.Info("merged specs", "file", o.mergePath)
+	}
+	return err
+}
+
+func printPlan(plan []oam.PlannedFile) {
+	for _, p := range plan {
+		if p.Err != nil {
+			fmt.Printf("%s: %s\n", p.Repo, p.Err)
+			continue
+		}
+		url := p.URL
+		if p.Glob {
+			url += " (glob, expanded when fetching)"
+		}
+		if p.Asset != "" {
+			url += " (asset " + p.Asset + ", looked up when fetching)"
+		}
+		fmt.Printf("%s: GET %s -> %s (auth: %s)\n", p.Repo, url, p.Dest, p.Auth)
+	}
+}
+
+// printReachable writes a table of whether each planned URL is reachable to
+// w, failing if any isn't.
+func printReachable(w io.Writer, plan []oam.PlannedFile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tREPO\tSTATUS\tURL")
+	failed := 0
+	for _, p := range plan {
+		result, status := "pass", fmt.Sprint(p.Status)
+		switch {
+		case p.Err != nil:
+			result = "FAIL"
+			failed++
+			if p.Status == 0 {
+				status = p.Err.Error()
+			}
+		case p.Glob:
+			result, status = "skip", "glob, expanded when fetching"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result, p.Repo, status, p.URL)
+	}
+	tw.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d URLs unreachable", failed, len(plan))
+	}
+	return nil
+}
+
+// splitList returns the non-empty items of a comma-separated list.
+func splitList(list string) []string {
+	var items []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+// parseStatuses parses a comma-separated list of HTTP statuses, where a class
+// such as 5xx stands for all of its statuses.
+func parseStatuses(list string) ([]int, error) {
+	statuses := []int{}
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+			class := int(s[0]-'0') * 100
+			for code := class; code < class+100; code++ {
+				if code != http.StatusNotFound {
+					statuses = append(statuses, code)
+				}
+			}
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("%q is not an HTTP status", s)
+		}
+		if code == http.StatusNotFound {
+			return nil, errors.New("404 is never retried")
+		}
+		statuses = append(statuses, code)
+	}
+	return statuses, nil
+}
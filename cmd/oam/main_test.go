@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseStatuses(t *testing.T) {
+	statuses, err := parseStatuses("429,5xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 101 || statuses[0] != 429 || statuses[1] != 500 || statuses[100] != 599 {
+		t.Errorf("parseStatuses(429,5xx) = %v, want 429 and 500 to 599", statuses)
+	}
+
+	statuses, err = parseStatuses("4xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 99 || slices.Contains(statuses, 404) {
+		t.Errorf("parseStatuses(4xx) = %v, want 400 to 499 without 404", statuses)
+	}
+
+	statuses, err = parseStatuses(" 520 , ,503")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(statuses, []int{520, 503}) {
+		t.Errorf("parseStatuses = %v, want [520 503]", statuses)
+	}
+
+	for _, list := range []string{"404", "500,404", "abc", "5x", "6xx", "0xx", "99", "600", "-500", "50x"} {
+		if _, err := parseStatuses(list); err == nil {
+			t.Errorf("parseStatuses(%q) succeeded", list)
+		}
+	}
+}
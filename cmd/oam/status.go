@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/ogugu9/oam"
+)
+
+// runStatus implements `oam status`, summarizing how the config, the lock
+// and the output directory differ.
+func runStatus(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	c := addConfigFlags(flags)
+	var exitZero bool
+	flags.BoolVar(&exitZero, "exit-zero", false, "exit 0 even when something differs")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: oam status [flags]\n\nList the repos whose config differs from the lock file, and the files in the\noutput directory that are missing, modified or not in the lock. Nothing is\nfetched. Exits non-zero if anything differs, unless -exit-zero is set.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	config, lock, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	status, err := oam.Status(config, lock)
+	if err != nil {
+		return err
+	}
+	if status.Clean() {
+		fmt.Println("up to date: the lock matches the config and the output directory")
+		return nil
+	}
+	for _, c := range status.Repos {
+		fmt.Println(c)
+	}
+	for _, d := range status.Files {
+		fmt.Println(d)
+	}
+	if exitZero {
+		return nil
+	}
+	return errors.New("the config, lock and output directory differ")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ogugu9/oam"
+)
+
+// printTiming writes a table of how long each file took to download, and the
+// run's total, to w.
+func printTiming(w io.Writer, result *oam.Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tPATH\tSTATUS\tCACHED\tDNS\tCONNECT\tTLS\tFIRST BYTE\tTOTAL")
+	files, cached := 0, 0
+	for _, repo := range result.Repos() {
+		for _, f := range repo.Files {
+			files++
+			status := fmt.Sprint(f.Status)
+			if f.Err != nil {
+				status = "failed"
+				if f.Status != 0 {
+					status = fmt.Sprintf("failed (%d)", f.Status)
+				}
+			}
+			hit := "no"
+			if f.Cached {
+				hit = "yes"
+				cached++
+			}
+			t := f.Timing
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", f.Repo, f.Path, status, hit,
+				ms(t.DNS), ms(t.Connect), ms(t.TLS), ms(t.FirstByte), ms(f.Duration))
+		}
+	}
+	tw.Flush()
+
+	rate := 0
+	if files > 0 {
+		rate = cached * 100 / files
+	}
+	fmt.Fprintf(w, "%d files in %s, %d from cache (%d%%)\n", files, result.Duration.Round(time.Millisecond), cached, rate)
+}
+
+func ms(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/ogugu9/oam"
+)
+
+// runVerify implements `oam verify`, checking the output directory against
+// the lock.
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	c := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: oam verify [flags]\n\nCheck that the files in the output directory match the checksums in the lock\nfile, listing every missing, modified or extra file. Nothing is fetched or\nwritten. Exits non-zero if anything differs.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	config, lock, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	drift, err := oam.Verify(config.OutputDir, lock)
+	if err != nil {
+		return err
+	}
+	for _, d := range drift {
+		fmt.Println(d)
+	}
+	if len(drift) > 0 {
+		return fmt.Errorf("%d files in %s differ from %s", len(drift), config.OutputDir, c.lockPath)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ogugu9/oam"
+)
+
+// watchDebounce is how long the config must be quiet before a re-run, so an
+// editor's burst of writes triggers only one.
+const watchDebounce = 300 * time.Millisecond
+
+// watchConfig fetches once and again after every change to the config file or
+// the files it includes, until ctx is cancelled. Failed runs are logged and
+// watching continues. The fetcher is reused, so unchanged files come from its
+// in-memory cache.
+func watchConfig(ctx context.Context, f *oam.Fetcher, o options) error {
+	if o.configPath == "-" {
+		return errors.New("-watch needs a config file, not stdin")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch the directories rather than the files, since many editors save
+	// by replacing the file.
+	configPath := filepath.Clean(o.configPath)
+	w := &configWatcher{watcher: watcher, files: map[string]bool{}, dirs: map[string]bool{}}
+	if err := w.update(configPath); err != nil {
+		return err
+	}
+
+	run := func() {
+		if err := fetchOnce(ctx, f, o); err != nil && ctx.Err() == nil {
+			slog.Error("run failed", "err", err)
+		}
+		// Includes may have been added or removed.
+		if err := w.update(configPath); err != nil {
+			slog.Warn("watch error", "err", err)
+		}
+		slog.Info("watching for changes", "config", configPath)
+	}
+	run()
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if w.files[filepath.Clean(ev.Name)] && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce = time.After(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("watch error", "err", err)
+		case <-debounce:
+			debounce = nil
+			slog.Info("config changed, fetching again", "config", configPath)
+			run()
+		}
+	}
+}
+
+// configWatcher watches the directories of a config file and its includes.
+type configWatcher struct {
+	watcher *fsnotify.Watcher
+	files   map[string]bool // Absolute paths of the config and its includes.
+	dirs    map[string]bool // Directories being watched.
+}
+
+// update reads the config at path for the files it includes, then watches
+// their directories and stops watching those no longer needed. A config that
+// can't be read keeps the files found before the error, and at least path.
+func (w *configWatcher) update(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	_, files, _ := oam.ReadConfigFiles(path)
+	w.files = map[string]bool{abs: true}
+	for _, file := range files {
+		w.files[file] = true
+	}
+
+	dirs := map[string]bool{}
+	for file := range w.files {
+		dirs[filepath.Dir(file)] = true
+	}
+	for dir := range dirs {
+		if w.dirs[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			if dir == filepath.Dir(abs) {
+				return err
+			}
+			// An include in a missing directory is reported by the run.
+			slog.Warn("failed to watch include directory", "dir", dir, "err", err)
+			delete(dirs, dir)
+		}
+	}
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			w.watcher.Remove(dir)
+		}
+	}
+	w.dirs = dirs
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestConfigWatcherFollowsIncludes(t *testing.T) {
+	dir := t.TempDir()
+	teams := filepath.Join(dir, "teams")
+	if err := os.Mkdir(teams, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "oam.yaml")
+	include := filepath.Join(teams, "a.yaml")
+	write := func(path, data string) {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(config, "include: [teams/a.yaml]\n")
+	write(include, "repos: {}\n")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	w := &configWatcher{watcher: watcher, files: map[string]bool{}, dirs: map[string]bool{}}
+	if err := w.update(config); err != nil {
+		t.Fatal(err)
+	}
+	if !w.files[include] || !w.dirs[teams] || !w.dirs[dir] {
+		t.Fatalf("watching files %v in %v, want the include in %s too", w.files, w.dirs, teams)
+	}
+
+	// Dropping the include stops watching its directory.
+	write(config, "repos: {}\n")
+	if err := w.update(config); err != nil {
+		t.Fatal(err)
+	}
+	if w.files[include] || w.dirs[teams] {
+		t.Errorf("still watching files %v in %v after the include was removed", w.files, w.dirs)
+	}
+	for _, d := range watcher.WatchList() {
+		if d == teams {
+			t.Errorf("fsnotify still watches %s", teams)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package oam
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// limitCooldown is how long after reducing the limit further rate-limit
+// responses are put down to the same burst rather than reducing it again.
+const limitCooldown = 5 * time.Second
+
+// concurrencyLimit bounds the requests a run has in flight, adjusting the
+// bound additive-increase/multiplicative-decrease style: every rate-limit
+// response halves it, down to min, and it grows by one after as many
+// successful responses as the current bound, up to max.
+type concurrencyLimit struct {
+	min, max int
+	log      *slog.Logger
+
+	mu        sync.Mutex
+	limit     int
+	inFlight  int
+	successes int           // Successful responses since the limit last changed.
+	reduced   time.Time     // When the limit was last reduced.
+	changed   chan struct{} // Closed when a slot may have become free.
+}
+
+// newConcurrencyLimit returns a limit starting at hi that never goes below lo.
+func newConcurrencyLimit(lo, hi int, log *slog.Logger) *concurrencyLimit {
+	if lo < 1 {
+		lo = 1
+	}
+	if lo > hi {
+		lo = hi
+	}
+	return &concurrencyLimit{min: lo, max: hi, log: log, limit: hi, changed: make(chan struct{})}
+}
+
+// acquire waits for a free slot or until ctx is done.
+func (l *concurrencyLimit) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		wait := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *concurrencyLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// rateLimited halves the limit, unless it was already reduced for the same
+// burst of responses.
+func (l *concurrencyLimit) rateLimited() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.successes = 0
+	if l.limit == l.min || time.Since(l.reduced) < limitCooldown {
+		return
+	}
+	old := l.limit
+	l.limit = max(l.limit/2, l.min)
+	l.reduced = time.Now()
+	l.log.Info("rate limited, reducing concurrency", "from", old, "to", l.limit)
+}
+
+// succeeded counts a response that was not rate limited, raising the limit
+// by one once there have been as many as the limit.
+func (l *concurrencyLimit) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit == l.max {
+		return
+	}
+	if l.successes++; l.successes < l.limit {
+		return
+	}
+	l.successes = 0
+	l.limit++
+	l.log.Info("increasing concurrency", "to", l.limit)
+	l.notify()
+}
+
+func (l *concurrencyLimit) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+type concurrencyLimitKey struct{}
+
+// withConcurrencyLimit returns a context whose requests report their
+// responses to l.
+func withConcurrencyLimit(ctx context.Context, l *concurrencyLimit) context.Context {
+	return context.WithValue(ctx, concurrencyLimitKey{}, l)
+}
+
+// concurrencyLimitFrom returns the limit requests with ctx report to, if any.
+func concurrencyLimitFrom(ctx context.Context) *concurrencyLimit {
+	l, _ := ctx.Value(concurrencyLimitKey{}).(*concurrencyLimit)
+	return l
+}
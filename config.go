@@ -0,0 +1,453 @@
+package oam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v2"
+)
+
+// Repo describes where to fetch specs from.
+type Repo struct {
+	URL      string `yaml:"url" json:"url"`
+	Version  string `yaml:"version" json:"version"`
+	Path     Paths  `yaml:"path" json:"path"`
+	Token    string `yaml:"token" json:"token"`         // Token for this repo, overriding GITHUB_TOKEN.
+	TokenEnv string `yaml:"token_env" json:"token_env"` // Environment variable holding the token for this repo.
+	Provider string `yaml:"provider" json:"provider"`   // Hosting provider: github (default), gitlab or bitbucket.
+	BaseURL  string `yaml:"base_url" json:"base_url"`   // Raw file host, overriding the provider default.
+	APIURL   string `yaml:"api_url" json:"api_url"`     // GitHub API root, required with a custom base_url.
+	Format   string `yaml:"format" json:"format"`       // Output format: yaml or json; the fetched spec's by default.
+	SHA256   string `yaml:"sha256" json:"sha256"`       // Expected checksum of the fetched file.
+	RefType  string `yaml:"ref_type" json:"ref_type"`   // What version names: branch, tag or commit; any of them when empty.
+	// Vendor extensions to remove from the specs, overriding the fetcher's.
+	StripExtensions Extensions `yaml:"strip_extensions" json:"strip_extensions"`
+	Filter          *Filter    `yaml:"filter" json:"filter"` // Paths and operations to keep from the specs.
+	// GitHub release asset to fetch instead of files in the tree, from the
+	// release tagged version, or the latest release when it is latest.
+	Asset string `yaml:"asset" json:"asset"`
+	// Format of the asset when it is an archive to extract path from: tar.gz or zip.
+	Archive string `yaml:"archive" json:"archive"`
+	// File to write the spec to, relative to the output directory, instead of
+	// the default or templated name. Only for repos fetching a single file.
+	Output string `yaml:"output" json:"output"`
+	// Extra headers sent with every request for the repo. They are applied
+	// last, so naming Authorization or User-Agent replaces the default.
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	// Directory of a local working copy to read path from instead of
+	// fetching it, relative to the current directory. Url and version are
+	// then optional.
+	LocalPath string `yaml:"local_path" json:"local_path"`
+	// Skip TLS certificate verification for the repo's requests, e.g. for a
+	// host with a self-signed certificate. Anyone on the network path can
+	// then tamper with the specs.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+	// OpenAPI Overlay document whose actions are applied to the specs before
+	// they are filtered, relative to the config file the repo is in.
+	Overlay string `yaml:"overlay" json:"overlay"`
+	// Fail specs when an action of the overlay matches nothing in them.
+	OverlayStrict bool `yaml:"overlay_strict" json:"overlay_strict"`
+	// Set to false to leave the repo out of runs without removing it from
+	// the config. Its lock entry and files are kept.
+	Enabled *bool `yaml:"enabled" json:"enabled"`
+
+	ref string // Version before it was pinned to a commit.
+	dir string // Directory of the config file the repo is in.
+}
+
+const (
+	refBranch = "branch"
+	refTag    = "tag"
+	refCommit = "commit"
+)
+
+var commitPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// DefaultOutputDir is where specs are written when the config sets no
+// output_dir.
+const DefaultOutputDir = "./oam"
+
+const defaultConcurrency = 20
+
+// Config is the contents of an oam.yaml or oam.json file.
+type Config struct {
+	OutputDir string `yaml:"output_dir" json:"output_dir"`
+	BaseURL   string `yaml:"base_url" json:"base_url"` // Raw file host for GitHub repos, e.g. GitHub Enterprise.
+	APIURL    string `yaml:"api_url" json:"api_url"`   // GitHub API root matching base_url.
+	// Maximum number of parallel requests. Very high values risk hitting
+	// GitHub's secondary rate limits.
+	Concurrency int `yaml:"concurrency" json:"concurrency"`
+	// Repos to fetch, keyed by an alias naming their output directory and
+	// lock entry. The alias needn't be the repo's name, so the same repo can
+	// be listed more than once, e.g. at two versions.
+	Repos   map[string]Repo `yaml:"repos" json:"repos"`
+	Include []string        `yaml:"include" json:"include"` // Files whose repos are merged into this config.
+	Hooks   Hooks           `yaml:"hooks" json:"hooks"`
+}
+
+// ReadConfig reads and parses the config file at path, or stdin if path is
+// "-". The repos of included files are merged in; include paths are relative
+// to the including file.
+func ReadConfig(path string) (Config, error) {
+	config, _, err := ReadConfigFiles(path)
+	return config, err
+}
+
+// ReadConfigFiles is like ReadConfig but also returns the absolute paths of
+// the config file and every file it includes, directly or not. On error they
+// are the files read or tried until then, so a missing include is among them.
+func ReadConfigFiles(path string) (Config, []string, error) {
+	origin := map[string]string{}
+	var files []string
+	config, err := readConfig(path, nil, origin, &files)
+	return config, files, err
+}
+
+// readConfig reads the config at path and its includes. stack holds the
+// absolute paths of the files including it, origin the file each repo was
+// defined in, and files those read so far.
+func readConfig(path string, stack []string, origin map[string]string, files *[]string) (Config, error) {
+	var config Config
+	abs := "stdin"
+	if path != "-" {
+		abs = path
+		if a, absErr := filepath.Abs(path); absErr == nil {
+			abs = a
+		}
+		*files = append(*files, abs)
+	}
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = readStdin()
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, fmt.Errorf("config file not found: %s", abs)
+	}
+	if err != nil {
+		return config, err
+	}
+
+	if err := unmarshalConfig(path, data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	dir := "."
+	if path != "-" {
+		dir = filepath.Dir(path)
+	}
+	for name, r := range config.Repos {
+		if prev, ok := origin[name]; ok {
+			return config, fmt.Errorf("repo %s is defined in both %s and %s", name, prev, abs)
+		}
+		origin[name] = abs
+		r.dir = dir
+		config.Repos[name] = r
+	}
+
+	stack = append(stack, abs)
+	for _, inc := range config.Include {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(dir, inc)
+		}
+		incAbs, err := filepath.Abs(inc)
+		if err != nil {
+			return config, err
+		}
+		for i, p := range stack {
+			if p == incAbs {
+				return config, fmt.Errorf("circular include: %s", strings.Join(append(stack[i:], incAbs), " -> "))
+			}
+		}
+
+		sub, err := readConfig(inc, stack, origin, files)
+		if err != nil {
+			return config, err
+		}
+		if config.Repos == nil {
+			config.Repos = map[string]Repo{}
+		}
+		for name, r := range sub.Repos {
+			config.Repos[name] = r
+		}
+	}
+	config.Include = nil
+	return config, nil
+}
+
+// unmarshalConfig parses data as JSON if path ends in .json and as YAML
+// otherwise. Config read from stdin is tried as JSON first.
+func unmarshalConfig(path string, data []byte, config *Config) error {
+	switch {
+	case strings.EqualFold(filepath.Ext(path), ".json"):
+		return json.Unmarshal(data, config)
+	case path == "-":
+		if json.Unmarshal(data, config) == nil {
+			return nil
+		}
+		*config = Config{}
+	}
+	return yaml.Unmarshal(data, config)
+}
+
+// readStdin reads all of stdin, failing instead of waiting for input when it
+// is a terminal.
+func readStdin() ([]byte, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeCharDevice != 0 {
+		return nil, errors.New("config is - but stdin is a terminal; pipe the config in")
+	}
+	return io.ReadAll(os.Stdin)
+}
+
+// Validate checks the config for missing and invalid values, reporting every
+// problem found in a single error.
+func (c Config) Validate() error {
+	var problems []string
+	if c.Concurrency < 0 {
+		problems = append(problems, fmt.Sprintf("concurrency must be at least 1, got %d", c.Concurrency))
+	}
+	if _, err := normalizeBaseURL(c.BaseURL); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := normalizeBaseURL(c.APIURL); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	names := make([]string, 0, len(c.Repos))
+	for name := range c.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, p := range c.Repos[name].problems() {
+			if name == "" {
+				problems = append(problems, "repo with an empty name: "+p)
+			} else {
+				problems = append(problems, name+": "+p)
+			}
+		}
+		if name == "" {
+			problems = append(problems, "repo names must not be empty")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (r Repo) problems() []string {
+	var problems []string
+	if r.URL == "" && r.LocalPath == "" {
+		problems = append(problems, "url or local_path is required")
+	}
+	if r.Version == "" && r.LocalPath == "" {
+		problems = append(problems, "version is required")
+	}
+	if r.LocalPath != "" && r.Asset != "" {
+		problems = append(problems, "asset cannot be read from a local_path")
+	}
+	if r.Asset != "" {
+		if strings.ContainsAny(r.Asset, "/*?[") {
+			problems = append(problems, fmt.Sprintf("asset %q must be a file name", r.Asset))
+		}
+		if r.provider() != providerGitHub {
+			problems = append(problems, "asset is only supported for GitHub repos")
+		}
+		if r.RefType == refBranch || r.RefType == refCommit {
+			problems = append(problems, fmt.Sprintf("asset needs a release tag, but ref_type is %s", r.RefType))
+		}
+	}
+	switch {
+	case r.Archive != "":
+		if r.Archive != archiveTarGz && r.Archive != archiveZip {
+			problems = append(problems, fmt.Sprintf("unknown archive %q", r.Archive))
+		}
+		if r.Asset == "" {
+			problems = append(problems, "archive needs an asset to extract from")
+		}
+		if len(r.Path) == 0 {
+			problems = append(problems, "path is required to select files from the archive")
+		}
+	case r.Asset != "" && len(r.Path) > 0:
+		problems = append(problems, "path and asset are mutually exclusive without archive")
+	case r.Asset == "" && len(r.Path) == 0:
+		problems = append(problems, "path or asset is required")
+	}
+	if r.Output != "" {
+		clean := path.Clean(filepath.ToSlash(r.Output))
+		switch {
+		case filepath.IsAbs(r.Output) || path.IsAbs(clean):
+			problems = append(problems, fmt.Sprintf("output %q must be relative to the output directory", r.Output))
+		case clean == "." || clean == ".." || strings.HasPrefix(clean, "../"):
+			problems = append(problems, fmt.Sprintf("output %q is not inside the output directory", r.Output))
+		}
+		if len(r.Path) > 1 || (len(r.Path) == 1 && isGlob(r.Path[0])) {
+			problems = append(problems, "output needs a single path that isn't a glob or directory")
+		}
+	}
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !httpguts.ValidHeaderFieldName(name) {
+			problems = append(problems, fmt.Sprintf("invalid header name %q", name))
+		} else if !httpguts.ValidHeaderFieldValue(r.Headers[name]) {
+			problems = append(problems, fmt.Sprintf("invalid value for header %s", name))
+		}
+	}
+	for i, p := range r.Path {
+		if p == "" {
+			problems = append(problems, fmt.Sprintf("path %d is empty", i+1))
+		}
+	}
+	switch r.provider() {
+	case providerGitHub, providerGitLab, providerBitbucket:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown provider %q", r.Provider))
+	}
+	switch r.RefType {
+	case "", refTag:
+	case refBranch, refCommit:
+		if r.Version == versionLatest || isConstraint(r.Version) {
+			problems = append(problems, fmt.Sprintf("version %q resolves to a tag, but ref_type is %s", r.Version, r.RefType))
+		} else if r.RefType == refCommit && r.Version != "" && !commitPattern.MatchString(r.Version) {
+			problems = append(problems, fmt.Sprintf("version %q is not a commit SHA", r.Version))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown ref_type %q", r.RefType))
+	}
+	switch r.Format {
+	case "", formatYAML, formatJSON:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown format %q", r.Format))
+	}
+	problems = append(problems, r.StripExtensions.problems()...)
+	problems = append(problems, r.Filter.problems()...)
+	if r.OverlayStrict && r.Overlay == "" {
+		problems = append(problems, "overlay_strict needs an overlay")
+	}
+	if _, err := normalizeBaseURL(r.BaseURL); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := normalizeBaseURL(r.APIURL); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// normalize validates the config and returns a copy with defaults and the
+// global base URLs applied.
+func (c Config) normalize() (Config, error) {
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+
+	repos := make(map[string]Repo, len(c.Repos))
+	for name, r := range c.Repos {
+		repos[name] = r
+	}
+	c.Repos = repos
+
+	if c.OutputDir == "" {
+		c.OutputDir = DefaultOutputDir
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = defaultConcurrency
+	}
+	return c, c.applyBaseURLs()
+}
+
+// Paths is a list of file paths that also accepts a single scalar in YAML.
+type Paths []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Paths) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = Paths{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *Paths) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*p = Paths{single}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// applyBaseURLs validates the base and API URLs and applies the global ones to
+// GitHub repos that don't set their own.
+func (c *Config) applyBaseURLs() error {
+	var err error
+	if c.BaseURL, err = normalizeBaseURL(c.BaseURL); err != nil {
+		return err
+	}
+	if c.APIURL, err = normalizeBaseURL(c.APIURL); err != nil {
+		return err
+	}
+
+	for name, r := range c.Repos {
+		if r.BaseURL, err = normalizeBaseURL(r.BaseURL); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if r.APIURL, err = normalizeBaseURL(r.APIURL); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if r.BaseURL == "" && r.provider() == providerGitHub {
+			r.BaseURL = c.BaseURL
+		}
+		if r.APIURL == "" && r.provider() == providerGitHub {
+			r.APIURL = c.APIURL
+		}
+		c.Repos[name] = r
+	}
+	return nil
+}
+
+func normalizeBaseURL(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q", s)
+	}
+	return strings.TrimRight(s, "/"), nil
+}
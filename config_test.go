@@ -0,0 +1,45 @@
+package oam
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadConfigFilesListsIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	main := write("oam.yaml", "include: [teams/a.yaml]\nrepos:\n  pets: {url: o/pets, version: main, path: openapi.yaml}\n")
+	a := write("teams/a.yaml", "include: [../shared/b.yaml]\nrepos:\n  users: {url: o/users, version: main, path: openapi.yaml}\n")
+	b := write("shared/b.yaml", "repos:\n  orders: {url: o/orders, version: main, path: openapi.yaml}\n")
+
+	config, files, err := ReadConfigFiles(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Repos) != 3 {
+		t.Errorf("got %d repos, want 3", len(config.Repos))
+	}
+	if want := []string{main, a, filepath.Clean(b)}; !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+
+	// A missing include is still listed, so it can be watched for.
+	write("shared/b.yaml", "include: [c.yaml]\n")
+	if _, files, err = ReadConfigFiles(main); err == nil {
+		t.Fatal("missing include read without an error")
+	}
+	if want := filepath.Join(dir, "shared", "c.yaml"); !slices.Contains(files, want) {
+		t.Errorf("files = %v, want %s among them", files, want)
+	}
+}
@@ -0,0 +1,48 @@
+package oam
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// DefaultContentTypes are the response media types accepted for files when
+// the fetcher has no list of its own. GitHub's raw host serves text/plain, and
+// release assets come as application/octet-stream.
+var DefaultContentTypes = []string{
+	"application/json",
+	"application/yaml",
+	"application/x-yaml",
+	"text/yaml",
+	"text/x-yaml",
+	"text/plain",
+	"application/octet-stream",
+	"application/vnd.oai.openapi",
+	"application/vnd.oai.openapi+json",
+}
+
+// checkContentType returns an error unless contentType, a Content-Type
+// header, is one of the allowed media types. An entry such as text/* allows
+// a whole type, and */* any. A missing header is allowed, as there is nothing
+// to go by.
+func (f *Fetcher) checkContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q", contentType)
+	}
+
+	allowed := f.AllowContentTypes
+	if allowed == nil {
+		allowed = DefaultContentTypes
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == media || a == "*/*" || (strings.HasSuffix(a, "/*") && strings.HasPrefix(media, strings.TrimSuffix(a, "*"))) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected Content-Type %s", media)
+}
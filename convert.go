@@ -0,0 +1,208 @@
+package oam
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// format returns the output format configured for the repo, defaulting to
+// the fetcher's, or "" to keep the format of the fetched spec.
+func (f *Fetcher) format(r Repo) string {
+	if r.Format != "" {
+		return r.Format
+	}
+	return f.Format
+}
+
+// outputFormat returns the format the target is written in: the configured
+// one, else that of the fetched spec, or before fetching the one the path's
+// extension suggests.
+func (f *Fetcher) outputFormat(t target) string {
+	if format := f.format(t.Repo); format != "" {
+		return format
+	}
+	if t.format != "" {
+		return t.format
+	}
+	if strings.EqualFold(path.Ext(t.Path), ".json") {
+		return formatJSON
+	}
+	return formatYAML
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// detectFormat reports whether data is JSON or YAML, ignoring a byte order
+// mark and leading whitespace.
+func detectFormat(data []byte) string {
+	data = bytes.TrimLeft(bytes.TrimPrefix(data, utf8BOM), " \t\r\n")
+	if len(data) > 0 && (data[0] == '{' || data[0] == '[') && json.Valid(data) {
+		return formatJSON
+	}
+	return formatYAML
+}
+
+// convert re-encodes data in the requested format. YAML is written as
+// fetched, and JSON asked for as YAML is converted to it.
+func convert(data []byte, format string) ([]byte, error) {
+	switch format {
+	case formatYAML:
+		if detectFormat(data) == formatJSON {
+			return jsonToYAML(data)
+		}
+		return data, nil
+	case formatJSON:
+		return yamlToJSON(data)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// yamlToJSON converts a YAML document to indented JSON, keeping the key order.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, doc); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// jsonToYAML converts a JSON document to YAML, keeping the key order.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(bytes.TrimPrefix(data, utf8BOM), &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// canonicalYAML re-encodes a YAML document the way yaml.Marshal writes it,
+// optionally sorting the keys of every mapping. Comments are dropped and
+// aliases are expanded into copies of what their anchors hold. The result is
+// checked to decode to the same content as data.
+func canonicalYAML(data []byte, sortKeys bool) ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var v interface{} = doc
+	if sortKeys {
+		v = sortMapKeys(doc)
+	}
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	same, err := sameContent(data, out)
+	if err != nil {
+		return nil, err
+	}
+	if !same {
+		return nil, errors.New("re-encoding changes its content")
+	}
+	return out, nil
+}
+
+// sameContent reports whether two YAML documents hold the same values,
+// whatever the order of their keys.
+func sameContent(a, b []byte) (bool, error) {
+	var values [2]interface{}
+	for i, data := range [][]byte{a, b} {
+		js, err := yamlToJSON(data)
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(js, &values[i]); err != nil {
+			return false, err
+		}
+	}
+	return reflect.DeepEqual(values[0], values[1]), nil
+}
+
+// sortMapKeys returns v with the keys of every mapping in it sorted.
+func sortMapKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		sorted := make(yaml.MapSlice, len(v))
+		for i, item := range v {
+			sorted[i] = yaml.MapItem{Key: item.Key, Value: sortMapKeys(item.Value)}
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return fmt.Sprint(sorted[i].Key) < fmt.Sprint(sorted[j].Key)
+		})
+		return sorted
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = sortMapKeys(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+func encodeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		buf.WriteByte('{')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(fmt.Sprint(item.Key))
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, item.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
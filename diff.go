@@ -0,0 +1,191 @@
+package oam
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const diffContext = 3 // Lines of context around each hunk.
+
+// printDiff writes d to DiffOutput, keeping diffs from concurrent fetches
+// from interleaving.
+func (f *Fetcher) printDiff(d string) {
+	f.diffMu.Lock()
+	defer f.diffMu.Unlock()
+	var w io.Writer = os.Stdout
+	if f.DiffOutput != nil {
+		w = f.DiffOutput
+	}
+	fmt.Fprint(w, d)
+}
+
+type editOp int
+
+const (
+	opEqual editOp = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	op   editOp
+	line string
+}
+
+// unifiedDiff returns a unified diff from a to b, or an empty string when they
+// are equal.
+func unifiedDiff(aName, bName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	// Walk the edit script, emitting hunks of changes with surrounding context.
+	for start := 0; start < len(edits); {
+		for start < len(edits) && edits[start].op == opEqual {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+
+		end := start
+		for end < len(edits) {
+			if edits[end].op != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == opEqual {
+				run++
+			}
+			if run == len(edits) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+
+		from := max(start-diffContext, 0)
+		to := min(end+diffContext, len(edits))
+		aLine, bLine := 1, 1
+		for _, e := range edits[:from] {
+			if e.op != opInsert {
+				aLine++
+			}
+			if e.op != opDelete {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != opInsert {
+				aCount++
+			}
+			if e.op != opDelete {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for _, e := range edits[from:to] {
+			out.WriteString([]string{" ", "-", "+"}[e.op])
+			out.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script from a to b with Myers' algorithm.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	maxD := n + m
+	v := make([]int, 2*maxD+2)
+	var trace [][]int // For each d, v[k] for k in [-d, d] before round d.
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[maxD-d:maxD+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[maxD+k-1] < v[maxD+k+1]) {
+				x = v[maxD+k+1]
+			} else {
+				x = v[maxD+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[maxD+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, d)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, a, b []string, d int) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{opEqual, a[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{opInsert, b[y]})
+		} else {
+			x--
+			edits = append(edits, edit{opDelete, a[x]})
+		}
+	}
+	for x > 0 {
+		x--
+		edits = append(edits, edit{opEqual, a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
@@ -0,0 +1,102 @@
+package oam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheEntry holds the metadata stored next to a cached response body,
+// including whichever validators the server sent.
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Next         string `json:"next,omitempty"` // Next page of an API listing.
+	// Until when the body is served without revalidating it, with CacheTTL.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// fresh reports whether the entry can be used without asking the server.
+func (e cacheEntry) fresh() bool {
+	return time.Now().Before(e.Expires)
+}
+
+// cacheExpiry returns when an entry stored or revalidated now expires, or the
+// zero time without CacheTTL.
+func (f *Fetcher) cacheExpiry() time.Time {
+	if f.CacheTTL <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(f.CacheTTL)
+}
+
+// DefaultCacheDir returns the oam directory under the user's cache dir.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "oam")
+}
+
+// cachePaths returns the metadata and body file paths for url.
+func (f *Fetcher) cachePaths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(f.CacheDir, key+".json"), filepath.Join(f.CacheDir, key+".body")
+}
+
+// loadCached returns the cached entry and body for url, if present. With
+// Force nothing is.
+func (f *Fetcher) loadCached(url string) (cacheEntry, []byte, bool) {
+	var entry cacheEntry
+	if f.CacheDir == "" || f.Force {
+		return entry, nil, false
+	}
+
+	metaPath, bodyPath := f.cachePaths(url)
+	meta, err := os.ReadFile(metaPath)
+	if err != nil {
+		return entry, nil, false
+	}
+	if err := json.Unmarshal(meta, &entry); err != nil || entry.URL != url {
+		return entry, nil, false
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return entry, nil, false
+	}
+	return entry, body, true
+}
+
+// storeCached saves body and its validators for url.
+func (f *Fetcher) storeCached(entry cacheEntry, body []byte) error {
+	if f.CacheDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(f.CacheDir, 0700); err != nil {
+		return err
+	}
+
+	_, bodyPath := f.cachePaths(entry.URL)
+	// The body goes first, so its metadata never describes a body not yet written.
+	if err := writeAtomic(bodyPath, body, 0600); err != nil {
+		return err
+	}
+	return f.storeCachedEntry(entry)
+}
+
+// storeCachedEntry saves the metadata of a cached body, such as its new
+// expiry after revalidating it.
+func (f *Fetcher) storeCachedEntry(entry cacheEntry) error {
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	metaPath, _ := f.cachePaths(entry.URL)
+	return writeAtomic(metaPath, meta, 0600)
+}
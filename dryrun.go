@@ -0,0 +1,197 @@
+package oam
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PlannedFile is a file a run would fetch.
+type PlannedFile struct {
+	Repo string // Repo name, the key in the config.
+	URL  string // URL the file would be downloaded from.
+	Dest string // Path the file would be written to; a directory for globs.
+	Glob bool   // Whether the path is a glob, expanded only when fetching.
+	// Release asset listed by URL, whose download URL is looked up only when fetching.
+	Asset string
+	Auth  string // Authentication method: basic, bearer token, private token or none.
+	Err   error  // Why the file can't be fetched.
+
+	// HTTP status of the URL with CheckReachable, 0 if not checked; 200 for
+	// local files that exist.
+	Status int
+
+	repo  Repo   // Repo the file is fetched from, with the version pinned.
+	local string // Path of a local file.
+}
+
+// Plan lists what each repo would fetch and where it would be written,
+// without any network or disk access, sorted by repo name. Versions pinned in
+// the fetcher's lock are used; symbolic versions and globs are left unresolved.
+// Repos a run would leave out are not listed.
+func (f *Fetcher) Plan(config Config) ([]PlannedFile, error) {
+	_, plan, err := f.plan(config)
+	return plan, err
+}
+
+// plan is Plan, also returning the normalized config.
+func (f *Fetcher) plan(config Config) (Config, []PlannedFile, error) {
+	config, _, err := f.selectRepos(config)
+	if err != nil {
+		return config, nil, err
+	}
+	config, err = config.normalize()
+	if err != nil {
+		return config, nil, err
+	}
+
+	names := make([]string, 0, len(config.Repos))
+	for name := range config.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var plan []PlannedFile
+	for _, name := range names {
+		r := config.Repos[name]
+		r.ref = r.Version
+		if old, ok := f.Lock.Repos[name]; ok && old.URL == r.URL && old.Version == r.Version && old.Commit != "" {
+			r.Version = old.Commit
+		}
+
+		paths := []string(r.Path)
+		if r.Asset != "" && r.Archive == "" {
+			paths = []string{r.Asset}
+		}
+		for _, p := range paths {
+			t := plainTarget(name, r, p)
+			url, err := r.rawURL(p)
+			var local string
+			switch {
+			case r.LocalPath != "":
+				local = filepath.Join(r.LocalPath, filepath.FromSlash(p))
+				url, err = localURL(local), nil
+			case r.Asset != "":
+				url, err = r.releaseURL()
+			}
+			if err != nil {
+				plan = append(plan, PlannedFile{Repo: name, Err: err})
+				continue
+			}
+			relFile, err := f.relFile(t)
+			if err != nil {
+				plan = append(plan, PlannedFile{Repo: name, Err: err})
+				continue
+			}
+			dest := filepath.Join(config.OutputDir, relFile)
+			if isGlob(p) {
+				dest = filepath.Join(config.OutputDir, name) + string(filepath.Separator)
+			}
+			plan = append(plan, PlannedFile{Repo: name, URL: url, Dest: dest, Glob: isGlob(p), Asset: r.Asset, Auth: f.authMethod(r, url), repo: r, local: local})
+		}
+	}
+	return config, plan, nil
+}
+
+// PlanReachable is Plan, then checks that each URL answers a HEAD request,
+// with the concurrency and rate limit handling of a run, without downloading
+// or writing anything. Servers that don't support HEAD are sent a GET whose
+// body is not read. A 200 or 304 sets the file's Status; any other answer
+// sets Err too. Globs are not checked.
+func (f *Fetcher) PlanReachable(ctx context.Context, config Config) ([]PlannedFile, error) {
+	config, plan, err := f.plan(config)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := newConcurrencyLimit(f.MinConcurrency, config.Concurrency, f.logger())
+	ctx = withConcurrencyLimit(ctx, limit)
+	var wg sync.WaitGroup
+	for i := range plan {
+		p := &plan[i]
+		if p.Err != nil || p.Glob {
+			continue
+		}
+		if p.local != "" {
+			if _, p.Err = os.Stat(p.local); p.Err == nil {
+				p.Status = http.StatusOK
+			}
+			continue
+		}
+		if err := limit.acquire(ctx); err != nil {
+			p.Err = err
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer limit.release()
+			p.Status, p.Err = f.reachable(ctx, p.repo, p.URL)
+		}()
+	}
+	wg.Wait()
+	return plan, nil
+}
+
+// reachable returns the status of a HEAD request for url, and an error unless
+// it is 200 or 304.
+func (f *Fetcher) reachable(ctx context.Context, r Repo, url string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout())
+	defer cancel()
+	client := f.clientFor(r)
+	res, err := f.reachableRequest(ctx, client, r, http.MethodHead, url)
+	if err == nil && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+		res.Body.Close()
+		res, err = f.reachableRequest(ctx, client, r, http.MethodGet, url)
+	}
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotModified {
+		return res.StatusCode, &statusError{URL: url, StatusCode: res.StatusCode, Status: res.Status}
+	}
+	return res.StatusCode, nil
+}
+
+func (f *Fetcher) reachableRequest(ctx context.Context, client *http.Client, r Repo, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.setAuth(req, r); err != nil {
+		return nil, err
+	}
+	return f.doWithRetry(client, req)
+}
+
+// authMethod describes the authentication setAuth would use for url, without
+// the secret.
+func (f *Fetcher) authMethod(r Repo, url string) string {
+	if r.LocalPath != "" {
+		return "none"
+	}
+	if f.App != nil && r.provider() == providerGitHub && r.token() == "" {
+		// Minting a token would take a request.
+		return "GitHub App"
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "none"
+	}
+	f.setAuth(req, r)
+
+	switch auth := req.Header.Get("Authorization"); {
+	case strings.HasPrefix(auth, "Basic "):
+		return "basic"
+	case strings.HasPrefix(auth, "Bearer "):
+		return "bearer token"
+	case req.Header.Get("PRIVATE-TOKEN") != "":
+		return "private token"
+	}
+	return "none"
+}
@@ -0,0 +1,56 @@
+package oam
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is sent on every request. Setting it ourselves turns off the
+// transport's transparent gzip handling, so readBody decodes responses, also
+// those a proxy compressed without being asked.
+const acceptEncoding = "gzip, deflate"
+
+// readBody reads the response body, decoding any gzip or deflate
+// Content-Encoding.
+func readBody(res *http.Response) ([]byte, error) {
+	return decodeBody(res.Body, res.Header.Get("Content-Encoding"))
+}
+
+// decodeBody reads body, decoding the Content-Encoding enc.
+func decodeBody(body io.Reader, enc string) ([]byte, error) {
+	r := body
+	switch enc := strings.ToLower(strings.TrimSpace(enc)); enc {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip response: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case "deflate":
+		// Deflate should be zlib-wrapped, but some servers send raw deflate.
+		br := bufio.NewReader(body)
+		if header, err := br.Peek(2); err == nil && (int(header[0])<<8|int(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("invalid deflate response: %w", err)
+			}
+			defer zr.Close()
+			r = zr
+		} else {
+			fr := flate.NewReader(br)
+			defer fr.Close()
+			r = fr
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,90 @@
+package oam
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv returns a copy of the config with ${VAR} in its string values
+// replaced by the environment variable's value. Unset variables are an error
+// unless allowUnset is set, in which case they expand to an empty string.
+// Hook commands are left alone, as the shell expands them when they run.
+func (c Config) ExpandEnv(allowUnset bool) (Config, error) {
+	unset := map[string]bool{}
+	expand := func(s string) string {
+		return envVarPattern.ReplaceAllStringFunc(s, func(m string) string {
+			name := m[2 : len(m)-1]
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				unset[name] = true
+			}
+			return v
+		})
+	}
+
+	v := reflect.ValueOf(&c).Elem()
+	expandValue(v, expand)
+
+	if len(unset) > 0 && !allowUnset {
+		names := make([]string, 0, len(unset))
+		for name := range unset {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return c, fmt.Errorf("config uses unset environment variables: %s", strings.Join(names, ", "))
+	}
+	return c, nil
+}
+
+// expandValue applies expand to every exported string in v, which must be
+// settable, skipping struct fields tagged expand:"-". Slices, maps and pointed to values
+// are copied so the caller's values are left untouched.
+func expandValue(v reflect.Value, expand func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(expand(v.String()))
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() && field.Tag.Get("expand") != "-" {
+				expandValue(v.Field(i), expand)
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(s, v)
+		for i := 0; i < s.Len(); i++ {
+			expandValue(s.Index(i), expand)
+		}
+		v.Set(s)
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			val := reflect.New(v.Type().Elem()).Elem()
+			val.Set(iter.Value())
+			expandValue(val, expand)
+			m.SetMapIndex(iter.Key(), val)
+		}
+		v.Set(m)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(v.Elem())
+		expandValue(p.Elem(), expand)
+		v.Set(p)
+	}
+}
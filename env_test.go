@@ -0,0 +1,22 @@
+package oam
+
+import "testing"
+
+func TestExpandEnvExpandsFilter(t *testing.T) {
+	t.Setenv("OAM_TEST_TAG", "public")
+	filter := &Filter{Tags: []string{"${OAM_TEST_TAG}"}}
+	config := Config{Repos: map[string]Repo{
+		"pets": {URL: "o/r", Version: "main", Filter: filter},
+	}}
+
+	expanded, err := config.ExpandEnv(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expanded.Repos["pets"].Filter.Tags[0]; got != "public" {
+		t.Errorf("filter tag = %q, want public", got)
+	}
+	if got := filter.Tags[0]; got != "${OAM_TEST_TAG}" {
+		t.Errorf("original filter tag changed to %q", got)
+	}
+}
@@ -0,0 +1,44 @@
+package oam
+
+import "errors"
+
+// FetchError is the error of a file that could not be fetched, or was fetched
+// but failed a later step such as validation, a transform or the write, saying
+// which repo and URL it came from. Err is the underlying failure, which
+// errors.Is and errors.As look through.
+type FetchError struct {
+	Repo       string // Repo name, the key in the config.
+	Path       string // Path of the file in the repo.
+	URL        string // URL the file was requested from; empty if it failed before that.
+	StatusCode int    // HTTP status of the response; 0 if there was none or it was 200.
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.Path == "" {
+		return e.Repo + ": " + e.Err.Error()
+	}
+	return e.Repo + ": " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetchError returns err as a *FetchError for the file at path in the repo.
+// An error that already is one keeps the repo and path it has, such as those
+// of an archive the file was to be extracted from.
+func fetchError(repoName, path string, err error) error {
+	fe, ok := err.(*FetchError)
+	if !ok {
+		fe = &FetchError{Err: err}
+	}
+	var se *statusError
+	if fe.StatusCode == 0 && errors.As(fe.Err, &se) {
+		fe.URL, fe.StatusCode = se.URL, se.StatusCode
+	}
+	if fe.Repo == "" {
+		fe.Repo, fe.Path = repoName, path
+	}
+	return fe
+}
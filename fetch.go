@@ -0,0 +1,1050 @@
+// Package oam fetches OpenAPI specs from Git hosting providers into a local
+// output directory, as described by a Config.
+package oam
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const defaultTimeout = 60 * time.Second
+
+// Fetcher downloads the specs listed in a Config. The zero value is ready to
+// use; a Fetcher may be reused across runs, sharing its in-memory cache.
+type Fetcher struct {
+	Client     *http.Client  // HTTP client; defaults to one using Timeout, Proxy and the transport settings below.
+	Proxy      *url.URL      // Proxy for all requests; defaults to HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+	Timeout    time.Duration // Timeout for each HTTP request; defaults to 60s.
+	Retries    int           // Number of retries for failed requests.
+	RetryDelay time.Duration // Base delay between retries, doubled on each attempt.
+	RetryOn    []int         // Statuses that are retried; defaults to 429 and 5xx. Rate limits are waited out either way.
+	UserAgent  string        // User-Agent of every request, including redirects; defaults to oam.
+
+	MaxIdleConnsPerHost int            // Idle connections kept open to each host; defaults to 20.
+	IdleConnTimeout     time.Duration  // How long idle connections are kept open; defaults to 90s.
+	KeepAlive           time.Duration  // Interval of TCP keep-alive probes; defaults to 30s, negative disables them.
+	Insecure            bool           // Skip TLS certificate verification for every repo, not only those setting insecure_skip_verify.
+	RootCAs             *x509.CertPool // Certificates trusted for TLS; defaults to the system's. See LoadCAFile.
+
+	Username string     // GitHub username for basic auth.
+	Token    string     // GitHub token, used when a repo has no token of its own.
+	App      *GitHubApp // GitHub App to authenticate as instead of Token.
+	Netrc    Netrc      // Credentials for GitHub hosts, used when there is no token.
+
+	CacheDir         string             // Directory of the on-disk cache; empty disables it.
+	CacheTTL         time.Duration      // How long cached files are used without revalidating them; 0 always revalidates.
+	Offline          bool               // Serve every request from the on-disk cache, never using the network.
+	SkipValidation   bool               // Write fetched files without checking they are OpenAPI specs.
+	ValidateSchema   bool               // Check each spec against the OpenAPI 3.0 or 3.1 JSON Schema before writing it.
+	Format           string             // Output format for repos that don't set one: yaml or json; specs keep their own when empty.
+	OutputTemplate   *template.Template // Output file names, see ParseOutputTemplate; defaults to {repo}/{name}.{ext}.
+	PreservePaths    bool               // Mirror the path in the repo under the repo's directory; ignored with OutputTemplate.
+	FollowRefs       bool               // Also download files referenced by relative $refs.
+	RefDepth         int                // Maximum depth of nested $ref files with FollowRefs; defaults to 10.
+	Bundle           bool               // Inline external $refs into components.
+	BundleComponents bool               // Inline only the external $refs to schemas, into components/schemas; Bundle wins over it.
+	MaxArchiveSize   int64              // Maximum total size of the files extracted from an archive; defaults to 256 MiB.
+	MaxSize          int64              // Maximum size of a downloaded file, as sent; no limit when 0.
+	Preflight        bool               // Send a HEAD request before each download, failing missing and, with MaxSize, large files early.
+
+	AllowContentTypes []string // Media types accepted for files, such as text/plain or text/*; defaults to DefaultContentTypes.
+
+	StripExtensions Extensions // Vendor extensions to remove from specs, for repos without strip_extensions.
+
+	Lint      []LintRule // Rules each spec is checked against, logging a warning per problem; see DefaultLintRules.
+	LintError bool       // Fail specs with lint problems instead of only warning.
+
+	// Transforms applied in order to each spec after every built-in step and
+	// before it is written, each getting the previous one's result.
+	Transforms []Transform
+
+	// Re-encode YAML specs with consistent indentation and quoting before
+	// writing them, and with SortKeys the keys of every mapping sorted.
+	FormatYAML bool
+	SortKeys   bool
+
+	AlwaysWrite bool      // Rewrite files even when their contents are unchanged.
+	Diff        bool      // Print a diff against existing files before overwriting them.
+	DiffOutput  io.Writer // Destination of diffs; defaults to os.Stdout.
+
+	// Fewest fetches kept in flight when rate limits cut the run's concurrency,
+	// which starts at and recovers to the config's; defaults to 1.
+	MinConcurrency int
+	// Most requests in flight to any one host, within the run's concurrency;
+	// defaults to 8.
+	MaxPerHost int
+
+	FailFast bool // Stop the run at the first failure.
+	Ordered  bool // Log each repo's messages together, in repo name order, once it has finished.
+
+	HookTimeout time.Duration // Timeout for each hook command; defaults to 1m.
+
+	Lock        Lock // Lock from a previous run, used to pin versions.
+	Update      bool // Re-resolve versions instead of using the pinned ones.
+	OnlyChanged bool // Skip repos whose url, version and path match the lock and whose files are unchanged on disk.
+
+	// Download and rewrite every file, neither serving it from the in-memory
+	// or on-disk cache nor skipping unchanged repos or files; the on-disk
+	// cache is still refreshed. Cannot be combined with Offline.
+	Force bool
+
+	// Most bytes of downloaded files kept in memory for later fetches of the
+	// same URL, least recently used evicted first; defaults to 256 MiB.
+	CacheMaxBytes int64
+
+	// Glob patterns of repo names, as path.Match takes them: when Only is set
+	// just the repos matching one of its patterns are fetched, and repos
+	// matching one of Skip's never are.
+	Only []string
+	Skip []string
+
+	Logger *slog.Logger // Defaults to slog.Default().
+
+	cache          memoryCache // Cache to store and retrieve OpenAPI files.
+	archives       sync.Map    // *archiveEntry of the extracted archives, keyed by the asset URL.
+	resolved       sync.Map    // Resolved versions, keyed by API URL, repo and version.
+	diffMu         sync.Mutex
+	rateMu         sync.Mutex
+	rateUntil      time.Time // No requests are sent before this time, after hitting a rate limit.
+	hostMu         sync.Mutex
+	hostSlots      map[string]chan struct{} // Semaphores of MaxPerHost slots, keyed by host.
+	clientOnce     sync.Once
+	httpClient     *http.Client
+	insecureOnce   sync.Once
+	insecureClient *http.Client
+}
+
+// Transform changes the contents of the spec at path in the repo before it
+// is written, such as to redact fields. An error fails the file, and so its
+// repo, but not the run's other repos.
+type Transform func(repo, path string, data []byte) ([]byte, error)
+
+// Option configures a Fetcher made by NewFetcher.
+type Option func(*Fetcher)
+
+// WithTransform adds fn to the fetcher's Transforms, after those already
+// there, for transforms that don't need the spec's path.
+func WithTransform(fn func(repo string, data []byte) ([]byte, error)) Option {
+	return func(f *Fetcher) {
+		f.Transforms = append(f.Transforms, func(repo, _ string, data []byte) ([]byte, error) {
+			return fn(repo, data)
+		})
+	}
+}
+
+// NewFetcher returns a fetcher with the options applied in order. It is the
+// same as setting the fields of a zero Fetcher, which is ready to use.
+func NewFetcher(opts ...Option) *Fetcher {
+	f := &Fetcher{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Result describes the outcome of a run.
+type Result struct {
+	OutputDir string        // Output directory the files were written to.
+	Files     []FileResult  // One entry per file, or per repo that failed before fetching.
+	Skipped   []SkippedRepo // Repos left out as disabled or by Only or Skip, sorted by name.
+	Lock      Lock          // Lock reflecting this run.
+	Duration  time.Duration // Wall-clock time of the run.
+}
+
+// FileResult is the outcome of fetching a single file.
+type FileResult struct {
+	Repo   string // Repo name, the key in the config.
+	Path   string // Path of the file in the repo.
+	Output string // Path of the written file, relative to the output directory.
+	SHA256 string // Checksum of the written file.
+	Bytes  int    // Size of the written file.
+
+	URL      string        // URL the file was downloaded from.
+	Status   int           // HTTP status of the download; 304 when revalidated from the disk cache.
+	Cached   bool          // Whether the file came from the in-memory or disk cache.
+	Duration time.Duration // Time spent downloading the file.
+	Timing   Timing        // Breakdown of Duration; zero for cached files.
+
+	SpecVersion string // Declared spec version, e.g. OpenAPI 3.1.0; empty for referenced files.
+
+	Err       error // A *FetchError when the file could not be downloaded.
+	Abandoned bool  // Whether the file was cut short or never fetched because the run was stopped.
+}
+
+// RepoResult is the outcome of a single repo.
+type RepoResult struct {
+	Repo  string       // Repo name, the key in the config.
+	Files []FileResult // The repo's files, sorted by path.
+	Err   error        // The errors of the failed files, joined; nil if none failed.
+}
+
+// Repos groups the file results by repo, sorted by repo name.
+func (r *Result) Repos() []RepoResult {
+	byRepo := map[string][]FileResult{}
+	for _, f := range r.Files {
+		byRepo[f.Repo] = append(byRepo[f.Repo], f)
+	}
+
+	repos := make([]RepoResult, 0, len(byRepo))
+	for name, files := range byRepo {
+		sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		var errs []error
+		for _, f := range files {
+			errs = append(errs, f.Err)
+		}
+		repos = append(repos, RepoResult{Repo: name, Files: files, Err: errors.Join(errs...)})
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Repo < repos[j].Repo })
+	return repos
+}
+
+// Abandoned returns the sorted names of the repos with files abandoned
+// because the run was stopped.
+func (r *Result) Abandoned() []string {
+	return r.repos(func(f FileResult) bool { return f.Abandoned })
+}
+
+// FailedRepos returns the sorted names of the repos with files that failed
+// outright, not counting abandoned ones.
+func (r *Result) FailedRepos() []string {
+	return r.repos(func(f FileResult) bool { return f.Err != nil && !f.Abandoned })
+}
+
+func (r *Result) repos(match func(FileResult) bool) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, f := range r.Files {
+		if match(f) && !seen[f.Repo] {
+			seen[f.Repo] = true
+			names = append(names, f.Repo)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Failed returns the number of files that failed.
+func (r *Result) Failed() int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// fetched is a downloaded file and how it was obtained.
+type fetched struct {
+	Data        []byte
+	URL         string
+	Status      int
+	Cached      bool
+	Duration    time.Duration
+	Timing      Timing
+	SpecVersion string // Set for specs, not for referenced files.
+}
+
+// target is a single file to fetch from a repo.
+type target struct {
+	Name string // Repo name, the key in the config.
+	Repo Repo
+	Path string // Path of the file in the repo.
+	Dest string // Output path relative to the repo's directory, without extension.
+
+	format string // Format of the fetched spec, once known.
+}
+
+// run holds the state of a single Run.
+type run struct {
+	f         *Fetcher
+	ctx       context.Context
+	cancel    context.CancelFunc // Cancels ctx, with FailFast.
+	outputDir string
+	hooks     Hooks
+	aborted   bool         // Whether FailFast stopped the run.
+	log       *slog.Logger // The fetcher's logger, or one ordering its records with Ordered.
+	ordered   *orderedLog  // Set with Ordered.
+
+	wg      sync.WaitGroup // WaitGroup to wait for all goroutines to finish.
+	mu      sync.Mutex
+	results []FileResult
+	pinned  map[string]LockedRepo // Lock entries for the repos in this run.
+	dests   map[string]string     // Source of every file written, as repo:path, by destination.
+	left    map[string]int        // Number of files of each repo still being fetched.
+}
+
+// forget empties the in-memory caches kept between runs, for Force.
+func (f *Fetcher) forget() {
+	f.cache.reset()
+	for _, m := range []*sync.Map{&f.archives, &f.resolved} {
+		m.Range(func(k, _ interface{}) bool {
+			m.Delete(k)
+			return true
+		})
+	}
+}
+
+// Run fetches every repo in config and writes the files to its output
+// directory. It returns an error if any file failed; the result lists the
+// outcome of each file either way. When ctx is cancelled no new fetches are
+// started, and files in flight are either written completely or not at all.
+func (f *Fetcher) Run(ctx context.Context, config Config) (*Result, error) {
+	config, skipped, err := f.selectRepos(config)
+	if err != nil {
+		return nil, err
+	}
+	config, err = config.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOutputDir(config.OutputDir); err != nil {
+		return nil, err
+	}
+	if f.Force {
+		if f.Offline {
+			return nil, errors.New("Force cannot be used with Offline")
+		}
+		f.forget()
+	}
+
+	start := time.Now()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	limit := newConcurrencyLimit(f.MinConcurrency, config.Concurrency, f.logger())
+	runCtx = withConcurrencyLimit(runCtx, limit)
+	r := &run{f: f, ctx: runCtx, cancel: cancel, outputDir: config.OutputDir, hooks: config.Hooks, log: f.logger(), pinned: map[string]LockedRepo{}, dests: map[string]string{}, left: map[string]int{}}
+
+	names := make([]string, 0, len(config.Repos))
+	for name := range config.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if f.Ordered {
+		r.ordered = newOrderedLog(f.logger().Handler(), names)
+		r.log = slog.New(r.ordered)
+	}
+	r.warnInsecure(config, names)
+	for _, s := range skipped {
+		r.logger().Info("skipping repo", "repo", s.Repo, "reason", s.Reason)
+	}
+
+	started := map[string]bool{}
+repos:
+	for _, repoName := range names {
+		if runCtx.Err() != nil {
+			break
+		}
+		started[repoName] = true
+
+		if f.OnlyChanged && !f.Force && r.skipUnchanged(repoName, config.Repos[repoName]) {
+			r.finish(repoName)
+			continue
+		}
+
+		repo, err := r.pinVersion(repoName, config.Repos[repoName])
+		if err != nil {
+			r.fail(repoName, "", err)
+			r.finish(repoName)
+			continue
+		}
+
+		ts, err := f.targets(runCtx, repoName, repo)
+		if err != nil {
+			r.fail(repoName, "", err)
+			r.finish(repoName)
+			continue
+		}
+		r.mu.Lock()
+		r.left[repoName] = len(ts)
+		r.mu.Unlock()
+
+		for _, t := range ts {
+			err := limit.acquire(runCtx) // Grab a spot, backing off while rate limited.
+			if err != nil {
+				// Cancelled: launch nothing more, and keep the repo's old lock entry.
+				r.fail(t.Name, "", err)
+				break repos
+			}
+
+			r.wg.Add(1) // Notify the WaitGroup that a new goroutine is starting.
+			go func(t target) {
+				defer r.wg.Done()     // Notify WaitGroup that this goroutine is done.
+				defer limit.release() // Release the spot.
+
+				if err := r.fetch(t); err != nil {
+					r.fail(t.Name, t.Path, err)
+				}
+				r.targetDone(t.Name)
+			}(t)
+		}
+	}
+
+	r.wg.Wait() // Wait for all goroutines to finish.
+
+	for _, repoName := range names {
+		if !started[repoName] {
+			r.fail(repoName, "", runCtx.Err())
+		}
+	}
+	if r.ordered != nil {
+		r.ordered.close()
+	}
+
+	result := &Result{OutputDir: config.OutputDir, Files: r.results, Skipped: skipped, Lock: r.lock(), Duration: time.Since(start)}
+	if err := ctx.Err(); err != nil {
+		msg := "run cancelled"
+		if errors.Is(err, context.DeadlineExceeded) {
+			msg = "run deadline exceeded"
+		}
+		return result, fmt.Errorf("%s; abandoned: %s; failed: %s: %w", msg, repoList(result.Abandoned()), repoList(result.FailedRepos()), err)
+	}
+	if r.aborted {
+		return result, fmt.Errorf("stopped after the first failure; %d of %d repos failed (%d of %d files)", len(result.FailedRepos()), len(names), result.Failed(), len(result.Files))
+	}
+	if n := result.Failed(); n > 0 {
+		return result, fmt.Errorf("%d of %d repos failed (%d of %d files)", len(result.FailedRepos()), len(names), n, len(result.Files))
+	}
+	return result, nil
+}
+
+func (r *run) fail(repoName, path string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	abandoned := r.ctx.Err() != nil
+	failure := FileResult{Repo: repoName, Path: path, Err: err, Abandoned: abandoned}
+	attrs := []any{"repo", repoName, "path", path}
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		if fe.Repo == repoName && fe.Path == path {
+			failure.URL, failure.Status = fe.URL, fe.StatusCode
+		}
+		if fe.URL != "" {
+			attrs = append(attrs, "url", fe.URL)
+		}
+		if fe.StatusCode != 0 {
+			attrs = append(attrs, "status", fe.StatusCode)
+		}
+	}
+	attrs = append(attrs, "err", err)
+	r.results = appendFailure(r.results, failure)
+
+	if r.aborted {
+		// Files cut short by the abort; the first failure was already reported.
+		r.logger().Debug("fetch stopped", attrs...)
+		return
+	}
+	if abandoned {
+		r.logger().Warn("fetch abandoned", attrs...)
+		return
+	}
+	r.logger().Error("fetch failed", attrs...)
+	if r.f.FailFast && r.ctx.Err() == nil {
+		r.aborted = true
+		r.cancel()
+	}
+}
+
+// targetDone notes that a file of the repo has been fetched or has failed.
+func (r *run) targetDone(repoName string) {
+	r.mu.Lock()
+	r.left[repoName]--
+	last := r.left[repoName] == 0
+	r.mu.Unlock()
+	if last {
+		r.finish(repoName)
+	}
+}
+
+// finish notes that the repo is done, writing out its ordered log records.
+func (r *run) finish(repoName string) {
+	if r.ordered != nil {
+		r.ordered.finish(repoName)
+	}
+}
+
+func (r *run) logger() *slog.Logger {
+	return r.log
+}
+
+// appendFailure adds a failure to results. A file that was already written
+// before a later step failed, such as a hook, is marked failed instead of
+// being listed twice.
+func appendFailure(results []FileResult, failure FileResult) []FileResult {
+	if failure.Path != "" {
+		for i := len(results) - 1; i >= 0; i-- {
+			if results[i].Repo == failure.Repo && results[i].Path == failure.Path && results[i].Err == nil {
+				results[i].Err, results[i].Abandoned = failure.Err, failure.Abandoned
+				return results
+			}
+		}
+	}
+	return append(results, failure)
+}
+
+func (r *run) fetch(t target) error {
+	ctx := r.ctx
+	if relFile, err := r.f.relFile(t); err == nil {
+		// Next to the output, where a later run finds it.
+		ctx = withPartFile(ctx, filepath.Join(r.outputDir, relFile)+".part")
+	}
+	file, err := r.f.download(ctx, t.Name, t.Repo, t.Path, !r.f.SkipValidation)
+	if err != nil {
+		return err
+	}
+	if err := r.process(t, file); err != nil {
+		return processError(t, file.URL, err)
+	}
+	return nil
+}
+
+// processError returns err, from handling the spec t downloaded from url, as
+// a *FetchError, unless it already is one, such as that of a referenced file.
+func processError(t target, url string, err error) error {
+	if _, ok := err.(*FetchError); ok {
+		return err
+	}
+	return &FetchError{Repo: t.Name, Path: t.Path, URL: url, Err: err}
+}
+
+// process checks, transforms and writes the downloaded spec t, with the files
+// it references when following them.
+func (r *run) process(t target, file *fetched) error {
+	var err error
+	data := file.Data
+	// Overlays, filters, bundling and stripping re-encode the spec as YAML, so
+	// note its format before any of them run.
+	t.format = detectFormat(data)
+
+	// Copy before annotating, since file may be shared through the cache.
+	src := *file
+	if v, ok := specVersion(data); ok {
+		src.SpecVersion = v
+		r.logger().Info("spec version", "repo", t.Name, "path", t.Path, "version", v)
+	} else {
+		r.logger().Warn("spec declares no OpenAPI version", "repo", t.Name, "path", t.Path)
+	}
+
+	if r.f.ValidateSchema {
+		err := validateSchema(data)
+		var se *schemaError
+		switch {
+		case err == nil:
+		case errors.Is(err, errNoSchema):
+			r.logger().Warn("not validating spec", "repo", t.Name, "path", t.Path, "err", err)
+		case errors.As(err, &se):
+			for _, p := range se.Problems {
+				r.logger().Error("schema violation", "repo", t.Name, "path", t.Path, "problem", p)
+			}
+			return fmt.Errorf("does not match the OpenAPI %s schema (%d problems)", se.Version, len(se.Problems))
+		default:
+			return err
+		}
+	}
+
+	if want := t.Repo.SHA256; want != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+			return fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", want, got)
+		}
+	}
+
+	if t.Repo.Overlay != "" {
+		if data, err = r.overlay(t, data); err != nil {
+			return err
+		}
+	}
+
+	if data, err = r.filter(t, data); err != nil {
+		return err
+	}
+
+	if r.f.Bundle || r.f.BundleComponents {
+		if data, err = r.bundle(t, data, !r.f.Bundle); err != nil {
+			return err
+		}
+	}
+
+	if data, err = r.strip(t, t.Path, data); err != nil {
+		return err
+	}
+
+	if len(r.f.Lint) > 0 {
+		if err := r.lint(t, data); err != nil {
+			return err
+		}
+	}
+
+	for i, transform := range r.f.Transforms {
+		if data, err = transform(t.Name, t.Path, data); err != nil {
+			return fmt.Errorf("transform %d: %w", i+1, err)
+		}
+	}
+
+	if detectFormat(data) != t.format {
+		if data, err = convert(data, t.format); err != nil {
+			return err
+		}
+	}
+	if !r.f.FollowRefs || r.f.Bundle {
+		if err := r.writeFile(t, &src, data); err != nil {
+			return err
+		}
+		return r.postFetch(t)
+	}
+
+	// Referenced files may not be written at the same relative location, so
+	// the spec is written with its $refs pointing at where they are.
+	specFile, err := r.f.relFile(t)
+	if err != nil {
+		return err
+	}
+	written, err := r.rewriteRefs(t, specFile, t.Path, data)
+	if err != nil {
+		return err
+	}
+	if err := r.writeFile(t, &src, written); err != nil {
+		return err
+	}
+	if err := r.fetchRefs(t, specFile, data); err != nil {
+		return err
+	}
+	return r.postFetch(t)
+}
+
+// strip removes the repo's configured vendor extensions from the spec at path.
+func (r *run) strip(t target, path string, data []byte) ([]byte, error) {
+	prefixes := r.f.stripExtensions(t.Repo)
+	data, n, err := stripSpec(data, prefixes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if n > 0 {
+		r.logger().Debug("stripped extensions", "repo", t.Name, "path", path, "prefixes", prefixes, "removed", n)
+	}
+	return data, nil
+}
+
+// download returns the contents of the file at path in the repo, from the
+// in-memory cache, the on-disk cache or the network. When validate is set the
+// file must be an OpenAPI spec. Errors are *FetchError.
+func (f *Fetcher) download(ctx context.Context, repoName string, r Repo, path string, validate bool) (*fetched, error) {
+	file, err := f.fetchFile(ctx, repoName, r, path, validate)
+	if err != nil {
+		return nil, fetchError(repoName, path, err)
+	}
+	return file, nil
+}
+
+func (f *Fetcher) fetchFile(ctx context.Context, repoName string, r Repo, path string, validate bool) (*fetched, error) {
+	if r.LocalPath != "" {
+		return readLocal(r, path, validate)
+	}
+	asset := r.Asset != "" && path == r.Asset
+	if r.Archive != "" && !asset {
+		return f.downloadFromArchive(ctx, repoName, r, path, validate)
+	}
+	var url string
+	var err error
+	if asset {
+		url, err = f.assetURL(ctx, r)
+	} else {
+		url, err = r.rawURL(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the data is already in cache.
+	if v, ok := f.cache.load(url); ok {
+		file := *v
+		file.Cached, file.Duration, file.Timing = true, 0, Timing{}
+		return &file, nil
+	}
+
+	if f.Offline {
+		return f.downloadOffline(url, validate)
+	}
+
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout())
+	defer cancel()
+	ctx, trace := withTiming(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if asset {
+		// The API redirects to the asset's download URL, dropping the auth header.
+		req.Header.Set("Accept", "application/octet-stream")
+	}
+	// If private repository, set necessary headers for authentication with GitHub token.
+	if err := f.setAuth(req, r); err != nil {
+		return nil, err
+	}
+
+	// Serve the on-disk copy, if any, while it is fresh, and otherwise
+	// revalidate it instead of downloading it again.
+	entry, cached, ok := f.loadCached(url)
+	if ok && entry.fresh() {
+		if validate {
+			if err := validateSpec(cached); err != nil {
+				return nil, &FetchError{URL: url, Err: fmt.Errorf("invalid spec from %s: %w", url, err)}
+			}
+		}
+		f.logger().Debug("serving from disk cache", "repo", repoName, "url", url, "expires", entry.Expires)
+		file := &fetched{Data: cached, URL: url, Cached: true, Duration: time.Since(start)}
+		f.cache.store(url, file, f.cacheMaxBytes())
+		return file, nil
+	}
+	if ok && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if ok && entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+	// Carry on with the download an earlier run was interrupted in, if any.
+	var part *partDownload
+	if name := partFileFrom(ctx); name != "" {
+		part = f.loadPart(name, url)
+	}
+	if part.resumable() {
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(part.data)))
+		req.Header.Set("If-Range", part.meta.Validator)
+	}
+
+	client := f.clientFor(r)
+	if f.Preflight {
+		if err := f.preflight(client, req); err != nil {
+			return nil, &FetchError{URL: url, Err: err}
+		}
+	}
+	res, err := f.doWithRetry(client, req)
+	if err != nil {
+		return nil, &FetchError{URL: url, Err: err}
+	}
+	defer res.Body.Close()
+
+	var fileData []byte
+	switch {
+	case res.StatusCode == http.StatusNotModified && ok:
+		fileData = cached
+	case res.StatusCode == 200 || res.StatusCode == http.StatusPartialContent && part.resumable():
+		// Archives are binary, and extracting them checks their format.
+		if r.Archive == "" {
+			if err := f.checkContentType(res.Header.Get("Content-Type")); err != nil {
+				return nil, &FetchError{URL: url, Err: fmt.Errorf("%s: %w", url, err)}
+			}
+		}
+		size := res.ContentLength
+		if res.StatusCode == http.StatusPartialContent && size >= 0 {
+			size += int64(len(part.data))
+		}
+		if err := f.checkSize(req, size); err != nil {
+			return nil, &FetchError{URL: url, Err: err}
+		}
+		fileData, err = f.readFull(client, req, res, part)
+		if err != nil {
+			return nil, &FetchError{URL: url, Err: err}
+		}
+	default:
+		return nil, &statusError{URL: url, StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	if validate {
+		if err := validateSpec(fileData); err != nil {
+			return nil, &FetchError{URL: url, Err: fmt.Errorf("invalid spec from %s: %w", url, err)}
+		}
+	}
+
+	if res.StatusCode != http.StatusNotModified {
+		entry = cacheEntry{URL: url, ETag: res.Header.Get("ETag"), LastModified: res.Header.Get("Last-Modified"), Expires: f.cacheExpiry()}
+		if err := f.storeCached(entry, fileData); err != nil {
+			f.logger().Warn("failed to cache response", "repo", repoName, "url", url, "err", err)
+		}
+	} else if f.CacheTTL > 0 {
+		// Still valid: good for another TTL.
+		entry.Expires = f.cacheExpiry()
+		if err := f.storeCachedEntry(entry); err != nil {
+			f.logger().Warn("failed to cache response", "repo", repoName, "url", url, "err", err)
+		}
+	}
+
+	file := &fetched{
+		Data:     fileData,
+		URL:      url,
+		Status:   res.StatusCode,
+		Cached:   res.StatusCode == http.StatusNotModified,
+		Duration: time.Since(start),
+		Timing:   trace.get(),
+	}
+
+	// Save the file data to the cache.
+	f.cache.store(url, file, f.cacheMaxBytes())
+
+	return file, nil
+}
+
+// writeFile converts data, the possibly bundled contents of file, to the
+// configured format, if any, and writes it.
+func (r *run) writeFile(t target, file *fetched, data []byte) error {
+	if format := r.f.format(t.Repo); format != "" {
+		var err error
+		if data, err = convert(data, format); err != nil {
+			return err
+		}
+	}
+	if r.f.FormatYAML && detectFormat(data) == formatYAML {
+		var err error
+		if data, err = canonicalYAML(data, r.f.SortKeys); err != nil {
+			return fmt.Errorf("failed to format: %w", err)
+		}
+	}
+
+	relFile, err := r.f.relFile(t)
+	if err != nil {
+		return err
+	}
+	return r.saveFile(file, t.Name, t.Path, relFile, data)
+}
+
+// saveFile writes data, read from src, to relFile under the output directory
+// and records it.
+func (r *run) saveFile(src *fetched, repoName, path, relFile string, data []byte) error {
+	destFile := filepath.Join(r.outputDir, relFile)
+	if err := r.claim(destFile, repoName, path); err != nil {
+		return err
+	}
+
+	always := r.f.AlwaysWrite || r.f.Force
+	if r.f.Diff || !always {
+		old, err := os.ReadFile(destFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// Leave identical files alone, keeping their modification times.
+		if err == nil && bytes.Equal(old, data) && !always {
+			r.logger().Info("unchanged", "repo", repoName, "path", path, "file", destFile)
+			r.record(src, repoName, path, relFile, data)
+			return nil
+		}
+		if r.f.Diff {
+			oldName := destFile
+			if err != nil {
+				oldName = "/dev/null"
+			}
+			r.f.printDiff(unifiedDiff(oldName, destFile, old, data))
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(destFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = writeAtomic(destFile, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	r.logger().Info("saved", "repo", repoName, "path", path, "file", destFile)
+	r.record(src, repoName, path, relFile, data)
+	return nil
+}
+
+// claim reserves destFile for the file at path in the repo, failing if a
+// different file has already been written there in this run.
+func (r *run) claim(destFile, repoName, path string) error {
+	source := repoName + ":" + path
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev, ok := r.dests[destFile]; ok && prev != source {
+		return fmt.Errorf("%s and %s both write %s", prev, source, destFile)
+	}
+	r.dests[destFile] = source
+	return nil
+}
+
+func repoList(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// writeAtomic writes data to a temporary file next to name and renames it into
+// place, so an interrupted run never leaves a partially written file.
+func writeAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// record adds a successfully written file to the results.
+func (r *run) record(src *fetched, repoName, path, relFile string, data []byte) {
+	sum := sha256.Sum256(data)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, FileResult{
+		Repo:     repoName,
+		Path:     path,
+		Output:   filepath.ToSlash(relFile),
+		SHA256:   hex.EncodeToString(sum[:]),
+		Bytes:    len(data),
+		URL:      src.URL,
+		Status:   src.Status,
+		Cached:   src.Cached,
+		Duration: src.Duration,
+		Timing:   src.Timing,
+
+		SpecVersion: src.SpecVersion,
+	})
+}
+
+// downloadOffline returns the on-disk copy of url.
+func (f *Fetcher) downloadOffline(url string, validate bool) (*fetched, error) {
+	_, data, ok := f.loadCached(url)
+	if !ok {
+		return nil, &FetchError{URL: url, Err: fmt.Errorf("%s not in cache", url)}
+	}
+	if validate {
+		if err := validateSpec(data); err != nil {
+			return nil, &FetchError{URL: url, Err: fmt.Errorf("invalid spec from %s: %w", url, err)}
+		}
+	}
+	file := &fetched{Data: data, URL: url, Cached: true}
+	f.cache.store(url, file, f.cacheMaxBytes())
+	return file, nil
+}
+
+// targets lists the files to fetch for a repo, expanding globs and
+// directories. A repo with a single plain path keeps the repo name as its
+// file name; otherwise names are derived from the paths.
+func (f *Fetcher) targets(ctx context.Context, repoName string, r Repo) ([]target, error) {
+	if r.Asset != "" && r.Archive == "" {
+		return []target{{Name: repoName, Repo: r, Path: r.Asset, Dest: repoName}}, nil
+	}
+
+	var ts []target
+	for _, p := range r.Path {
+		if !isGlob(p) {
+			ts = append(ts, plainTarget(repoName, r, p))
+			continue
+		}
+
+		files, err := f.listFiles(ctx, repoName, r)
+		if err != nil {
+			return nil, err
+		}
+		pattern := globPattern(p)
+		base := globBase(pattern)
+		matched := 0
+		for _, file := range files {
+			if !matchGlob(pattern, file) || (strings.HasSuffix(p, "/") && !isSpecFile(file)) {
+				continue
+			}
+			matched++
+			dest := trimExt(strings.TrimPrefix(file, base))
+			ts = append(ts, target{Name: repoName, Repo: r, Path: file, Dest: dest})
+		}
+		if matched == 0 {
+			return nil, fmt.Errorf("%s: no files match %s", repoName, p)
+		}
+	}
+	return ts, nil
+}
+
+// listFiles returns the paths of all files in the repo's archive, working
+// copy or tree.
+func (f *Fetcher) listFiles(ctx context.Context, repoName string, r Repo) ([]string, error) {
+	if r.Archive != "" {
+		_, files, err := f.archive(ctx, repoName, r)
+		if err != nil {
+			return nil, err
+		}
+		return files.names(), nil
+	}
+	if r.LocalPath != "" {
+		return listLocal(repoName, r)
+	}
+	files, err := f.listTree(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", repoName, err)
+	}
+	return files, nil
+}
+
+func plainTarget(repoName string, r Repo, p string) target {
+	dest := repoName
+	if len(r.Path) > 1 {
+		dest = strings.ReplaceAll(strings.Trim(trimExt(p), "/"), "/", "-")
+	}
+	return target{Name: repoName, Repo: r, Path: p, Dest: dest}
+}
+
+func trimExt(p string) string {
+	return strings.TrimSuffix(p, path.Ext(p))
+}
+
+func (f *Fetcher) logger() *slog.Logger {
+	if f.Logger != nil {
+		return f.Logger
+	}
+	return slog.Default()
+}
+
+func (f *Fetcher) timeout() time.Duration {
+	if f.Timeout > 0 {
+		return f.Timeout
+	}
+	return defaultTimeout
+}
+
+func (f *Fetcher) client() *http.Client {
+	f.clientOnce.Do(func() {
+		f.httpClient = f.Client
+		if f.httpClient == nil {
+			f.httpClient = &http.Client{Timeout: f.timeout(), Transport: f.transport()}
+		}
+	})
+	return f.httpClient
+}
@@ -0,0 +1,205 @@
+package oam
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testSpec = "openapi: 3.0.0\ninfo:\n  title: Pets\n  version: \"1\"\npaths: {}\n"
+
+// testFetcher returns a fetcher that logs nothing.
+func testFetcher() *Fetcher {
+	return &Fetcher{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// testConfig returns a config fetching the repos from baseURL into a
+// temporary directory.
+func testConfig(t *testing.T, baseURL string, repos map[string]Repo) Config {
+	return Config{OutputDir: t.TempDir(), BaseURL: baseURL, Repos: repos}
+}
+
+// readOutput returns the contents of the file written for the repo.
+func readOutput(t *testing.T, result *Result, repo string) []byte {
+	t.Helper()
+	for _, f := range result.Files {
+		if f.Repo == repo && f.Err == nil {
+			data, err := os.ReadFile(filepath.Join(result.OutputDir, f.Output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}
+	}
+	t.Fatalf("no file written for %s", repo)
+	return nil
+}
+
+func TestRunDecompressesGzip(t *testing.T) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte(testSpec))
+	zw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body.Bytes())
+	}))
+	defer srv.Close()
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"pets": {URL: "o/r", Version: "main", Path: Paths{"openapi.yaml"}},
+	})
+	result, err := testFetcher().Run(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readOutput(t, result, "pets"); string(got) != testSpec {
+		t.Errorf("written file = %q, want %q", got, testSpec)
+	}
+}
+
+func TestRunRevalidatesWithLastModified(t *testing.T) {
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	var requests []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Header.Clone())
+		if req.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		io.WriteString(w, testSpec)
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"pets": {URL: "o/r", Version: "main", Path: Paths{"openapi.yaml"}},
+	})
+	for run := 1; run <= 2; run++ {
+		// A new fetcher each time, as a new process would have.
+		f := testFetcher()
+		f.CacheDir = cacheDir
+		result, err := f.Run(context.Background(), config)
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if got := readOutput(t, result, "pets"); string(got) != testSpec {
+			t.Errorf("run %d: written file = %q, want %q", run, got, testSpec)
+		}
+		if run == 2 && (result.Files[0].Status != http.StatusNotModified || !result.Files[0].Cached) {
+			t.Errorf("run 2: status %d, cached %v, want 304 from the cache", result.Files[0].Status, result.Files[0].Cached)
+		}
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if got := requests[0].Get("If-Modified-Since"); got != "" {
+		t.Errorf("first request sent If-Modified-Since %q", got)
+	}
+	if got := requests[1].Get("If-Modified-Since"); got != lastModified {
+		t.Errorf("second request sent If-Modified-Since %q, want %q", got, lastModified)
+	}
+	if got := requests[1].Get("If-None-Match"); got != "" {
+		t.Errorf("second request sent If-None-Match %q without an ETag", got)
+	}
+}
+
+func TestRunReportsRepoErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/missing.yaml") {
+			http.NotFound(w, req)
+			return
+		}
+		io.WriteString(w, testSpec)
+	}))
+	defer srv.Close()
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"good":  {URL: "o/good", Version: "main", Path: Paths{"openapi.yaml"}},
+		"gone":  {URL: "o/gone", Version: "main", Path: Paths{"missing.yaml"}},
+		"mixed": {URL: "o/mixed", Version: "main", Path: Paths{"openapi.yaml", "missing.yaml"}},
+	})
+	config.Concurrency = 1
+	result, err := testFetcher().Run(context.Background(), config)
+	if err == nil {
+		t.Fatal("run with missing files succeeded")
+	}
+	if got, want := err.Error(), "2 of 3 repos failed (2 of 4 files)"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+
+	if got, want := result.FailedRepos(), []string{"gone", "mixed"}; !slices.Equal(got, want) {
+		t.Errorf("FailedRepos() = %v, want %v", got, want)
+	}
+	if got := result.Failed(); got != 2 {
+		t.Errorf("Failed() = %d, want 2", got)
+	}
+
+	for _, repo := range result.Repos() {
+		switch repo.Repo {
+		case "good":
+			if repo.Err != nil {
+				t.Errorf("good: %v", repo.Err)
+			}
+		case "gone", "mixed":
+			var fe *FetchError
+			if !errors.As(repo.Err, &fe) {
+				t.Fatalf("%s: error %v is not a *FetchError", repo.Repo, repo.Err)
+			}
+			if fe.Repo != repo.Repo || fe.Path != "missing.yaml" || fe.StatusCode != http.StatusNotFound {
+				t.Errorf("%s: FetchError{Repo: %q, Path: %q, StatusCode: %d}, want the 404 of missing.yaml", repo.Repo, fe.Repo, fe.Path, fe.StatusCode)
+			}
+			if !strings.HasSuffix(fe.URL, "/missing.yaml") {
+				t.Errorf("%s: FetchError URL = %q", repo.Repo, fe.URL)
+			}
+		default:
+			t.Errorf("unexpected repo %s", repo.Repo)
+		}
+	}
+
+	// The good file of the mixed repo is still written.
+	for _, f := range result.Files {
+		if f.Repo == "mixed" && f.Path == "openapi.yaml" && f.Err != nil {
+			t.Errorf("mixed/openapi.yaml: %v", f.Err)
+		}
+	}
+}
+
+func TestRunReportsProcessingErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, testSpec)
+	}))
+	defer srv.Close()
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"pets": {URL: "o/r", Version: "main", Path: Paths{"openapi.yaml"}, SHA256: strings.Repeat("0", 64)},
+	})
+	result, err := testFetcher().Run(context.Background(), config)
+	if err == nil {
+		t.Fatal("run with a checksum mismatch succeeded")
+	}
+
+	var fe *FetchError
+	if !errors.As(result.Files[0].Err, &fe) {
+		t.Fatalf("error %v is not a *FetchError", result.Files[0].Err)
+	}
+	if fe.Repo != "pets" || fe.Path != "openapi.yaml" || fe.URL != srv.URL+"/o/r/main/openapi.yaml" || fe.StatusCode != 0 {
+		t.Errorf("FetchError{Repo: %q, Path: %q, URL: %q, StatusCode: %d}", fe.Repo, fe.Path, fe.URL, fe.StatusCode)
+	}
+	if got := fe.Error(); !strings.HasPrefix(got, "pets: openapi.yaml: checksum mismatch: ") {
+		t.Errorf("error = %q", got)
+	}
+}
@@ -0,0 +1,247 @@
+package oam
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Filter selects the parts of a spec to keep. Components that were only
+// referenced by removed operations are removed with them.
+type Filter struct {
+	IncludePaths []string `yaml:"include_paths" json:"include_paths"` // Globs of paths to keep, e.g. /public/**; all when empty.
+	ExcludePaths []string `yaml:"exclude_paths" json:"exclude_paths"` // Globs of paths to remove, even when included.
+	Tags         []string `yaml:"tags" json:"tags"`                   // Keep only operations with one of these tags.
+}
+
+// operationKeys are the path item keys holding operations.
+var operationKeys = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+func (f *Filter) problems() []string {
+	if f == nil {
+		return nil
+	}
+	var problems []string
+	for _, p := range append(append([]string{}, f.IncludePaths...), f.ExcludePaths...) {
+		for _, seg := range strings.Split(p, "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("filter: invalid pattern %q", p))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+func (f *Filter) keepPath(p string) bool {
+	if len(f.IncludePaths) > 0 && !matchAny(f.IncludePaths, p) {
+		return false
+	}
+	return !matchAny(f.ExcludePaths, p)
+}
+
+func (f *Filter) keepOperation(op interface{}) bool {
+	if len(f.Tags) == 0 {
+		return true
+	}
+	m, _ := op.(yaml.MapSlice)
+	tags, _ := mapGet(m, "tags").([]interface{})
+	for _, tag := range tags {
+		for _, want := range f.Tags {
+			if fmt.Sprint(tag) == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter applies the repo's filter to the spec, returning it unchanged when
+// nothing is removed.
+func (r *run) filter(t target, data []byte) ([]byte, error) {
+	f := t.Repo.Filter
+	if f == nil {
+		return data, nil
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+
+	before := reachableComponents(doc)
+	paths, _ := mapGet(doc, "paths").(yaml.MapSlice)
+	kept := yaml.MapSlice{}
+	changed := false
+	for _, item := range paths {
+		p := fmt.Sprint(item.Key)
+		if !strings.HasPrefix(p, "/") {
+			kept = append(kept, item) // An extension.
+			continue
+		}
+		if !f.keepPath(p) {
+			changed = true
+			continue
+		}
+		pathItem, ok := item.Value.(yaml.MapSlice)
+		if !ok || len(f.Tags) == 0 {
+			kept = append(kept, item)
+			continue
+		}
+		var ops, removed int
+		keptItem := yaml.MapSlice{}
+		for _, field := range pathItem {
+			if operationKeys[fmt.Sprint(field.Key)] {
+				if !f.keepOperation(field.Value) {
+					removed++
+					continue
+				}
+				ops++
+			}
+			keptItem = append(keptItem, field)
+		}
+		if removed > 0 {
+			changed = true
+		}
+		if ops > 0 || removed == 0 {
+			kept = append(kept, yaml.MapItem{Key: item.Key, Value: keptItem})
+		}
+	}
+
+	total, remaining := countPaths(paths), countPaths(kept)
+	log := r.logger().Info
+	if remaining == 0 {
+		log = r.logger().Warn
+	}
+	log("filtered paths", "repo", t.Name, "path", t.Path, "kept", remaining, "removed", total-remaining)
+	if !changed {
+		return data, nil
+	}
+
+	doc = mapSet(doc, "paths", kept)
+	after := reachableComponents(doc)
+	for key := range before {
+		if !after[key] {
+			doc = removeComponent(doc, key)
+		}
+	}
+	return yaml.Marshal(doc)
+}
+
+func countPaths(paths yaml.MapSlice) int {
+	n := 0
+	for _, item := range paths {
+		if strings.HasPrefix(fmt.Sprint(item.Key), "/") {
+			n++
+		}
+	}
+	return n
+}
+
+// componentRoots are the root keys holding reusable definitions, in OpenAPI 3
+// and Swagger 2.
+var componentRoots = map[string]bool{
+	"components":  true,
+	"definitions": true,
+	"parameters":  true,
+	"responses":   true,
+}
+
+// componentKey returns the definition an internal ref points into, such as
+// components/schemas/User or definitions/User.
+func componentKey(ref string) (string, bool) {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return "", false
+	}
+	// Keep the segments escaped so the key is still a JSON pointer.
+	segs := strings.Split(pointer, "/")
+	n := 2
+	if len(segs) > 0 && segs[0] == "components" {
+		n = 3
+	}
+	if len(segs) < n || !componentRoots[segs[0]] {
+		return "", false
+	}
+	return strings.Join(segs[:n], "/"), true
+}
+
+// reachableComponents returns the definitions referenced, directly or through
+// other definitions, from outside the definition sections.
+func reachableComponents(doc yaml.MapSlice) map[string]bool {
+	seen := map[string]bool{}
+	var queue []string
+	visit := func(ref string) {
+		if key, ok := componentKey(ref); ok && !seen[key] {
+			seen[key] = true
+			queue = append(queue, key)
+		}
+	}
+	for _, item := range doc {
+		if !componentRoots[fmt.Sprint(item.Key)] {
+			walkMapRefs(item.Value, visit)
+		}
+	}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		if v, err := resolvePointer(doc, "/"+key); err == nil {
+			walkMapRefs(v, visit)
+		}
+	}
+	return seen
+}
+
+// walkMapRefs calls fn with the value of every $ref key in a document decoded
+// into yaml.MapSlice values.
+func walkMapRefs(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			if ref, ok := item.Value.(string); ok && item.Key == "$ref" {
+				fn(ref)
+				continue
+			}
+			walkMapRefs(item.Value, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkMapRefs(item, fn)
+		}
+	}
+}
+
+// removeComponent deletes the definition at key from doc.
+func removeComponent(doc yaml.MapSlice, key string) yaml.MapSlice {
+	segs := pointerSegments(key)
+	parent := doc
+	for _, seg := range segs[:len(segs)-2] {
+		parent, _ = mapGet(parent, seg).(yaml.MapSlice)
+	}
+	section := segs[len(segs)-2]
+	defs, ok := mapGet(parent, section).(yaml.MapSlice)
+	if !ok {
+		return doc
+	}
+	kept := yaml.MapSlice{}
+	for _, item := range defs {
+		if fmt.Sprint(item.Key) != segs[len(segs)-1] {
+			kept = append(kept, item)
+		}
+	}
+	mapSet(parent, section, kept)
+	return doc
+}
@@ -0,0 +1,287 @@
+package oam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultAPIURL = "https://api.github.com"
+
+// apiURL returns the GitHub REST API root for the repo. Repos with a custom
+// base_url must also set api_url, e.g. https://ghe.example.com/api/v3.
+func (r Repo) apiURL() (string, error) {
+	if r.provider() != providerGitHub {
+		return "", fmt.Errorf("provider %s has no GitHub API", r.provider())
+	}
+	if r.APIURL != "" {
+		return r.APIURL, nil
+	}
+	if r.BaseURL != "" {
+		return "", errors.New("api_url must be set when base_url is")
+	}
+	return defaultAPIURL, nil
+}
+
+// getJSON sends an authenticated GitHub API request and decodes the response into v.
+func (f *Fetcher) getJSON(ctx context.Context, r Repo, url string, v interface{}) error {
+	_, err := f.getJSONPage(ctx, r, url, v)
+	return err
+}
+
+// getJSONPage is like getJSON but also returns the URL of the next page from
+// the Link header, or an empty string on the last page. Responses are kept
+// in the on-disk cache and served from there when offline.
+func (f *Fetcher) getJSONPage(ctx context.Context, r Repo, url string, v interface{}) (string, error) {
+	if f.Offline {
+		entry, body, ok := f.loadCached(url)
+		if !ok {
+			return "", fmt.Errorf("%s not in cache", url)
+		}
+		return entry.Next, json.Unmarshal(body, v)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if err := f.setAuth(req, r); err != nil {
+		return "", err
+	}
+
+	res, err := f.doWithRetry(f.clientFor(r), req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return "", &statusError{URL: url, StatusCode: res.StatusCode, Status: res.Status}
+	}
+	body, err := readBody(res)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return "", err
+	}
+
+	// Keep the response for offline runs.
+	next := nextLink(res.Header.Get("Link"))
+	if err := f.storeCached(cacheEntry{URL: url, Next: next}, body); err != nil {
+		f.logger().Warn("failed to cache response", "url", url, "err", err)
+	}
+	return next, nil
+}
+
+// nextLink extracts the rel="next" URL from a Link header.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, p := range parts[1:] {
+			if strings.TrimSpace(p) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// statusError reports an unexpected HTTP status.
+type statusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed to fetch %s: %s", e.URL, e.Status)
+}
+
+type treeEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+}
+
+type treeResponse struct {
+	SHA       string      `json:"sha"`
+	Tree      []treeEntry `json:"tree"`
+	Truncated bool        `json:"truncated"`
+}
+
+// listTree returns the paths of all files in the repo at its version, using the
+// Git Trees API. Trees too large for a single recursive listing are walked one
+// directory at a time.
+func (f *Fetcher) listTree(ctx context.Context, r Repo) ([]string, error) {
+	api, err := r.apiURL()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := f.getTree(ctx, r, fmt.Sprintf("%s/repos/%s/git/trees/%s?recursive=1", api, r.URL, r.Version))
+	if err != nil {
+		return nil, err
+	}
+	if !tree.Truncated {
+		return blobs(tree.Tree, ""), nil
+	}
+	return f.walkTree(ctx, r, api, tree.SHA, "")
+}
+
+func (f *Fetcher) walkTree(ctx context.Context, r Repo, api, sha, prefix string) ([]string, error) {
+	tree, err := f.getTree(ctx, r, fmt.Sprintf("%s/repos/%s/git/trees/%s", api, r.URL, sha))
+	if err != nil {
+		return nil, err
+	}
+	if tree.Truncated {
+		// Listing it would silently miss files.
+		return nil, fmt.Errorf("directory %s has too many entries to list", strings.TrimSuffix(prefix, "/"))
+	}
+
+	files := blobs(tree.Tree, prefix)
+	for _, e := range tree.Tree {
+		if e.Type != "tree" {
+			continue
+		}
+		sub, err := f.walkTree(ctx, r, api, e.SHA, prefix+e.Path+"/")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, sub...)
+	}
+	return files, nil
+}
+
+// getTree fetches a tree, following rel="next" links of servers that paginate
+// it and collecting the entries of every page.
+func (f *Fetcher) getTree(ctx context.Context, r Repo, url string) (treeResponse, error) {
+	var tree treeResponse
+	for url != "" {
+		var page treeResponse
+		var err error
+		if url, err = f.getJSONPage(ctx, r, url, &page); err != nil {
+			return tree, err
+		}
+		if tree.SHA == "" {
+			tree.SHA = page.SHA
+		}
+		tree.Tree = append(tree.Tree, page.Tree...)
+		tree.Truncated = tree.Truncated || page.Truncated
+	}
+	return tree, nil
+}
+
+func blobs(entries []treeEntry, prefix string) []string {
+	var files []string
+	for _, e := range entries {
+		if e.Type == "blob" {
+			files = append(files, prefix+e.Path)
+		}
+	}
+	return files
+}
+
+// resolveCommit returns the SHA of the commit the repo's version points at.
+// A ref_type of branch or tag makes sure a same-named ref of the other kind
+// isn't picked instead.
+func (f *Fetcher) resolveCommit(ctx context.Context, r Repo) (string, error) {
+	api, err := r.apiURL()
+	if err != nil {
+		return "", err
+	}
+
+	ref := r.Version
+	switch r.RefType {
+	case refBranch:
+		ref = "heads/" + ref
+	case refTag:
+		ref = "tags/" + ref
+	}
+
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := f.getJSON(ctx, r, fmt.Sprintf("%s/repos/%s/commits/%s", api, r.URL, ref), &commit); err != nil {
+		return "", err
+	}
+	if commit.SHA == "" {
+		return "", errors.New("no commit SHA in response")
+	}
+	return commit.SHA, nil
+}
+
+// latestRelease returns the tag of the repo's newest non-prerelease release,
+// or false if the repo has none.
+func (f *Fetcher) latestRelease(ctx context.Context, r Repo) (string, bool, error) {
+	api, err := r.apiURL()
+	if err != nil {
+		return "", false, err
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	err = f.getJSON(ctx, r, fmt.Sprintf("%s/repos/%s/releases/latest", api, r.URL), &release)
+	var se *statusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return release.TagName, release.TagName != "", nil
+}
+
+// defaultBranch returns the name of the repo's default branch.
+func (f *Fetcher) defaultBranch(ctx context.Context, r Repo) (string, error) {
+	api, err := r.apiURL()
+	if err != nil {
+		return "", err
+	}
+
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := f.getJSON(ctx, r, fmt.Sprintf("%s/repos/%s", api, r.URL), &repo); err != nil {
+		return "", err
+	}
+	if repo.DefaultBranch == "" {
+		return "", errors.New("no default branch in response")
+	}
+	return repo.DefaultBranch, nil
+}
+
+// listTags returns the names of all tags in the repo, following pagination.
+func (f *Fetcher) listTags(ctx context.Context, r Repo) ([]string, error) {
+	api, err := r.apiURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	url := fmt.Sprintf("%s/repos/%s/tags?per_page=100", api, r.URL)
+	for url != "" {
+		var tags []struct {
+			Name string `json:"name"`
+		}
+		if url, err = f.getJSONPage(ctx, r, url, &tags); err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			names = append(names, t.Name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,64 @@
+package oam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+func TestRunFollowsTreePagination(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/repos/o/r/git/trees/"+testCommit && req.URL.Query().Get("page") == "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/o/r/git/trees/%s?recursive=1&page=2>; rel="next", <%[1]s/repos/o/r/git/trees/%[2]s?recursive=1&page=2>; rel="last"`, srv.URL, testCommit))
+			fmt.Fprintf(w, `{"sha":%q,"tree":[{"path":"specs","type":"tree","sha":"1"},{"path":"specs/a.yaml","type":"blob","sha":"2"}]}`, testCommit)
+		case req.URL.Path == "/repos/o/r/git/trees/"+testCommit && req.URL.Query().Get("page") == "2":
+			fmt.Fprintf(w, `{"sha":%q,"tree":[{"path":"specs/b.yaml","type":"blob","sha":"3"},{"path":"README.md","type":"blob","sha":"4"}]}`, testCommit)
+		case strings.HasPrefix(req.URL.Path, "/o/r/"+testCommit+"/specs/"):
+			fmt.Fprint(w, testSpec)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"pets": {URL: "o/r", Version: testCommit, RefType: refCommit, Path: Paths{"specs/*.yaml"}},
+	})
+	config.APIURL = srv.URL
+	result, err := testFetcher().Run(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range result.Files {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+	if want := []string{"specs/a.yaml", "specs/b.yaml"}; !slices.Equal(paths, want) {
+		t.Errorf("fetched %v, want %v", paths, want)
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct{ header, want string }{
+		{"", ""},
+		{`<https://api.example.com/x?page=2>; rel="next"`, "https://api.example.com/x?page=2"},
+		{`<https://api.example.com/x?page=1>; rel="prev", <https://api.example.com/x?page=3>; rel="next"`, "https://api.example.com/x?page=3"},
+		{`<https://api.example.com/x?page=5>; rel="last"`, ""},
+	}
+	for _, tt := range tests {
+		if got := nextLink(tt.header); got != tt.want {
+			t.Errorf("nextLink(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
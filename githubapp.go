@@ -0,0 +1,139 @@
+package oam
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHubApp authenticates GitHub requests as an installation of a GitHub App.
+// Installation tokens are minted as needed and kept in memory only.
+type GitHubApp struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKey     *rsa.PrivateKey
+	APIURL         string // REST API root; defaults to https://api.github.com.
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// tokenRefreshMargin is how long before it expires a token is replaced, so a
+// request never goes out with one that is about to lapse.
+const tokenRefreshMargin = 5 * time.Minute
+
+// ParseGitHubAppKey parses a GitHub App private key in PEM form, as PKCS #1
+// (what GitHub hands out) or PKCS #8.
+func ParseGitHubAppKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block in private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// appToken returns a valid installation token, minting a new one for a
+// request of r when there is none yet or the current one is about to expire.
+// The token must never be logged.
+func (f *Fetcher) appToken(ctx context.Context, r Repo) (string, error) {
+	app := f.App
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if app.token != "" && time.Until(app.expires) > tokenRefreshMargin {
+		return app.token, nil
+	}
+
+	jwt, err := app.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	api := app.APIURL
+	if api == "" {
+		api = defaultAPIURL
+	}
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", strings.TrimSuffix(api, "/"), app.InstallationID)
+	ctx, cancel := context.WithTimeout(ctx, f.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	res, err := f.doWithRetry(f.clientFor(r), req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get GitHub App installation token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to get GitHub App installation token: %s", res.Status)
+	}
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid GitHub App installation token response: %w", err)
+	}
+	if body.Token == "" {
+		return "", errors.New("invalid GitHub App installation token response: no token")
+	}
+
+	f.logger().Debug("minted GitHub App installation token", "app_id", app.AppID, "installation_id", app.InstallationID, "expires", body.ExpiresAt)
+	app.token, app.expires = body.Token, body.ExpiresAt
+	return app.token, nil
+}
+
+// jwt returns the RS256-signed JSON Web Token identifying the app. It is
+// backdated a minute for clock skew and lives for the nine minutes after
+// that, within GitHub's ten-minute limit.
+func (app *GitHubApp) jwt(now time.Time) (string, error) {
+	if app.PrivateKey == nil {
+		return "", errors.New("GitHub App has no private key")
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(app.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, app.PrivateKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
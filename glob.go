@@ -0,0 +1,69 @@
+package oam
+
+import (
+	"path"
+	"strings"
+)
+
+// isGlob reports whether p is a glob pattern or a directory ending in a slash.
+func isGlob(p string) bool {
+	return strings.HasSuffix(p, "/") || strings.ContainsAny(p, "*?[")
+}
+
+// globPattern turns a directory path into a pattern matching everything below it.
+func globPattern(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p + "**"
+	}
+	return p
+}
+
+// globBase returns the leading directories of pattern that contain no wildcards,
+// including the trailing slash.
+func globBase(pattern string) string {
+	segs := strings.Split(pattern, "/")
+	base := ""
+	for _, seg := range segs[:len(segs)-1] {
+		if strings.ContainsAny(seg, "*?[") {
+			break
+		}
+		base += seg + "/"
+	}
+	return base
+}
+
+// matchGlob matches a slash-separated name against pattern. In addition to the
+// path.Match syntax, a "**" segment matches any number of directories.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// isSpecFile reports whether name has a YAML or JSON extension.
+func isSpecFile(name string) bool {
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
@@ -1,8 +1,15 @@
 module github.com/ogugu9/oam
 
-go 1.20
+go 1.21
 
 require (
-	golang.org/x/sync v0.3.0
+	github.com/fsnotify/fsnotify v1.6.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	golang.org/x/net v0.20.0
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require (
+	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
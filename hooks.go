@@ -0,0 +1,91 @@
+package oam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const defaultHookTimeout = time.Minute
+
+// Hooks are commands run at points of a run.
+type Hooks struct {
+	// Shell commands run one after another after each spec is written, with
+	// OAM_FILE, OAM_REPO, OAM_PATH, OAM_VERSION and OAM_OUTPUT_DIR set.
+	PostFetch []string `yaml:"post_fetch" json:"post_fetch" expand:"-"`
+}
+
+func (f *Fetcher) hookTimeout() time.Duration {
+	if f.HookTimeout > 0 {
+		return f.HookTimeout
+	}
+	return defaultHookTimeout
+}
+
+// postFetch runs the post_fetch hooks for a written spec, stopping at the
+// first that fails.
+func (r *run) postFetch(t target) error {
+	if len(r.hooks.PostFetch) == 0 {
+		return nil
+	}
+	relFile, err := r.f.relFile(t)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(r.outputDir, relFile)
+	version := t.Repo.ref
+	if version == "" {
+		version = t.Repo.Version
+	}
+	env := append(os.Environ(),
+		"OAM_FILE="+file,
+		"OAM_REPO="+t.Name,
+		"OAM_PATH="+t.Path,
+		"OAM_VERSION="+version,
+		"OAM_OUTPUT_DIR="+r.outputDir,
+	)
+
+	for _, command := range r.hooks.PostFetch {
+		start := time.Now()
+		out, err := r.runHook(command, env)
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				err = fmt.Errorf("%w: %s", err, msg)
+			}
+			return fmt.Errorf("post_fetch hook %q failed for %s: %w", command, file, err)
+		}
+		r.logger().Info("ran hook", "repo", t.Name, "file", file, "command", command, "duration", time.Since(start).Round(time.Millisecond))
+		if len(out) > 0 {
+			r.logger().Debug("hook output", "repo", t.Name, "command", command, "output", string(out))
+		}
+	}
+	return nil
+}
+
+// runHook runs command with the system shell, returning its combined output.
+func (r *run) runHook(command string, env []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.f.hookTimeout())
+	defer cancel()
+
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(ctx, shell, flag, command)
+	cmd.Env = env
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return out.Bytes(), fmt.Errorf("timed out after %s", r.f.hookTimeout())
+	}
+	return out.Bytes(), err
+}
@@ -0,0 +1,68 @@
+package oam
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const defaultMaxPerHost = 8
+
+func (f *Fetcher) maxPerHost() int {
+	if f.MaxPerHost > 0 {
+		return f.MaxPerHost
+	}
+	return defaultMaxPerHost
+}
+
+// hostSlot waits for one of the slots of host, or until ctx is done, and
+// returns the function releasing it.
+func (f *Fetcher) hostSlot(ctx context.Context, host string) (func(), error) {
+	f.hostMu.Lock()
+	if f.hostSlots == nil {
+		f.hostSlots = map[string]chan struct{}{}
+	}
+	slots, ok := f.hostSlots[host]
+	if !ok {
+		slots = make(chan struct{}, f.maxPerHost())
+		f.hostSlots[host] = slots
+	}
+	f.hostMu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-slots }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// doHost sends req with client holding a slot of the request's host until the
+// response body is closed.
+func (f *Fetcher) doHost(client *http.Client, req *http.Request) (*http.Response, error) {
+	release, err := f.hostSlot(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	res.Body = &releaseOnClose{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// releaseOnClose is a response body that gives up its host slot when closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
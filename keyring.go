@@ -0,0 +1,62 @@
+package oam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrNoKeyring is returned by KeyringSecret when the platform has no keyring
+// it can read.
+var ErrNoKeyring = errors.New("no OS keyring available")
+
+// KeyringSecret returns the secret stored for service and account in the OS
+// keyring: the login Keychain on macOS, through the security command, the
+// Secret Service (GNOME Keyring, KWallet) elsewhere, through secret-tool, and
+// the Credential Manager on Windows, as the generic credential
+// service:account.
+func KeyringSecret(service, account string) (string, error) {
+	var secret string
+	var err error
+	switch runtime.GOOS {
+	case "windows":
+		secret, err = windowsCredential(service + ":" + account)
+	case "darwin", "ios":
+		secret, err = keyringCommand("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	default:
+		secret, err = keyringCommand("secret-tool", "lookup", "service", service, "account", account)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s/%s from the keyring: %w", service, account, err)
+	}
+	if secret == "" {
+		return "", fmt.Errorf("no secret for %s/%s in the keyring", service, account)
+	}
+	return secret, nil
+}
+
+// keyringCommand runs a keyring command line tool, returning what it prints
+// without the trailing newline. A missing tool is ErrNoKeyring.
+func keyringCommand(name string, args ...string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s not found", ErrNoKeyring, name)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		// Both tools exit non-zero without output for a missing secret.
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", name, msg)
+		}
+		if stdout.Len() == 0 {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package oam
+
+// windowsCredential is only available on Windows.
+func windowsCredential(target string) (string, error) {
+	return "", ErrNoKeyring
+}
@@ -0,0 +1,71 @@
+package oam
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32     = syscall.NewLazyDLL("advapi32.dll")
+	procCredRead = advapi32.NewProc("CredReadW")
+	procCredFree = advapi32.NewProc("CredFree")
+)
+
+const credTypeGeneric = 1
+
+// credential is the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// windowsCredential returns the password of the generic credential target
+// in the Credential Manager, or an empty string when there is none.
+func windowsCredential(target string) (string, error) {
+	if err := procCredRead.Find(); err != nil {
+		return "", ErrNoKeyring
+	}
+	name, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	ok, _, err := procCredRead.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ok == 0 {
+		if errors.Is(err, syscall.ERROR_NOT_FOUND) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	return decodeCredentialBlob(blob)
+}
+
+// decodeCredentialBlob decodes a password stored as UTF-16LE, as cmdkey and
+// the Credential Manager store them.
+func decodeCredentialBlob(blob []byte) (string, error) {
+	if len(blob)%2 != 0 {
+		return "", fmt.Errorf("credential of %d bytes is not UTF-16", len(blob))
+	}
+	units := make([]uint16, len(blob)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(blob[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,28 @@
+package oam
+
+import "testing"
+
+func TestDecodeCredentialBlob(t *testing.T) {
+	tests := []struct {
+		name string
+		blob []byte
+		want string
+	}{
+		{"empty", nil, ""},
+		{"ascii", []byte{'g', 0, 'h', 0, 'p', 0}, "ghp"},
+		{"non-latin", []byte{0x3a, 0x04, 0x3b, 0x04}, "кл"},
+		{"surrogate pair", []byte{0x3d, 0xd8, 0x11, 0xdd}, "\U0001f511"},
+	}
+	for _, tt := range tests {
+		got, err := decodeCredentialBlob(tt.blob)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := decodeCredentialBlob([]byte("abc")); err == nil {
+		t.Error("odd-length blob decoded without an error")
+	}
+}
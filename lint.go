@@ -0,0 +1,211 @@
+package oam
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintRule is a check run on every spec when the fetcher has lint rules.
+type LintRule interface {
+	Name() string
+	// Check returns a message for each problem in spec, which is decoded as
+	// JSON would be: objects are map[string]interface{} and arrays []interface{}.
+	Check(spec map[string]interface{}) []string
+}
+
+// DefaultLintRules returns the built-in rules: every operation has an
+// operationId, every response a description, and every component is used.
+func DefaultLintRules() []LintRule {
+	return []LintRule{operationIDRule{}, responseDescriptionRule{}, unusedComponentsRule{}}
+}
+
+// lintProblem is a problem found by a rule.
+type lintProblem struct {
+	Rule, Message string
+}
+
+// lint runs rules on data, returning the problems in rule order.
+func lint(data []byte, rules []LintRule) ([]lintProblem, error) {
+	js, err := yamlToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(js, &spec); err != nil {
+		return nil, err
+	}
+
+	var problems []lintProblem
+	for _, rule := range rules {
+		for _, msg := range rule.Check(spec) {
+			problems = append(problems, lintProblem{Rule: rule.Name(), Message: msg})
+		}
+	}
+	return problems, nil
+}
+
+// lint logs the lint problems of the spec at t, failing it with LintError.
+func (r *run) lint(t target, data []byte) error {
+	problems, err := lint(data, r.f.Lint)
+	if err != nil {
+		return fmt.Errorf("failed to parse: %w", err)
+	}
+	for _, p := range problems {
+		r.logger().Warn("lint", "repo", t.Name, "path", t.Path, "rule", p.Rule, "problem", p.Message)
+	}
+	if r.f.LintError && len(problems) > 0 {
+		return fmt.Errorf("%d lint problems", len(problems))
+	}
+	return nil
+}
+
+// lintOperation is an operation of a spec, such as GET /pets.
+type lintOperation struct {
+	method, path string
+	op           map[string]interface{}
+}
+
+func (o lintOperation) String() string {
+	return strings.ToUpper(o.method) + " " + o.path
+}
+
+// specOperations returns the operations under paths, sorted by path and method.
+func specOperations(spec map[string]interface{}) []lintOperation {
+	paths, _ := spec["paths"].(map[string]interface{})
+	var ops []lintOperation
+	for p, item := range paths {
+		item, _ := item.(map[string]interface{})
+		for method, op := range item {
+			if op, ok := op.(map[string]interface{}); ok && operationKeys[method] {
+				ops = append(ops, lintOperation{method: method, path: p, op: op})
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].path != ops[j].path {
+			return ops[i].path < ops[j].path
+		}
+		return ops[i].method < ops[j].method
+	})
+	return ops
+}
+
+type operationIDRule struct{}
+
+func (operationIDRule) Name() string { return "operation-id" }
+
+func (operationIDRule) Check(spec map[string]interface{}) []string {
+	var problems []string
+	for _, o := range specOperations(spec) {
+		if id, _ := o.op["operationId"].(string); id == "" {
+			problems = append(problems, fmt.Sprintf("%s has no operationId", o))
+		}
+	}
+	return problems
+}
+
+type responseDescriptionRule struct{}
+
+func (responseDescriptionRule) Name() string { return "response-description" }
+
+func (responseDescriptionRule) Check(spec map[string]interface{}) []string {
+	var problems []string
+	for _, o := range specOperations(spec) {
+		responses, _ := o.op["responses"].(map[string]interface{})
+		for _, code := range sortedKeys(responses) {
+			if !hasDescription(responses[code]) {
+				problems = append(problems, fmt.Sprintf("%s response %s has no description", o, code))
+			}
+		}
+	}
+	components, _ := spec["components"].(map[string]interface{})
+	responses, _ := components["responses"].(map[string]interface{})
+	for _, name := range sortedKeys(responses) {
+		if !hasDescription(responses[name]) {
+			problems = append(problems, fmt.Sprintf("response %s has no description", name))
+		}
+	}
+	return problems
+}
+
+// hasDescription reports whether a response has a description, or is a $ref
+// to one defined elsewhere.
+func hasDescription(v interface{}) bool {
+	res, _ := v.(map[string]interface{})
+	if _, ok := res["$ref"]; ok {
+		return true
+	}
+	desc, _ := res["description"].(string)
+	return desc != ""
+}
+
+type unusedComponentsRule struct{}
+
+func (unusedComponentsRule) Name() string { return "unused-components" }
+
+// Check reports the components no $ref in the spec points at. Security
+// schemes are referenced by name from security requirements, so they are not
+// checked. Swagger 2.0 definitions, parameters and responses are.
+func (unusedComponentsRule) Check(spec map[string]interface{}) []string {
+	used := map[string]bool{}
+	walkJSONRefs(spec, func(ref string) {
+		if strings.HasPrefix(ref, "#/") {
+			used[ref] = true
+		}
+	})
+
+	var problems []string
+	report := func(prefix string, section map[string]interface{}) {
+		for _, name := range sortedKeys(section) {
+			ref := prefix + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+			if !used[ref] {
+				problems = append(problems, fmt.Sprintf("%s is never referenced", strings.TrimPrefix(ref, "#/")))
+			}
+		}
+	}
+
+	components, _ := spec["components"].(map[string]interface{})
+	for _, sec := range sortedKeys(components) {
+		if sec == "securitySchemes" {
+			continue
+		}
+		section, _ := components[sec].(map[string]interface{})
+		report("#/components/"+sec+"/", section)
+	}
+	if _, ok := spec["swagger"]; ok {
+		for _, sec := range []string{"definitions", "parameters", "responses"} {
+			section, _ := spec[sec].(map[string]interface{})
+			report("#/"+sec+"/", section)
+		}
+	}
+	return problems
+}
+
+// walkJSONRefs calls fn with the value of every $ref in a JSON-decoded value.
+func walkJSONRefs(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if s, ok := val.(string); ok && k == "$ref" {
+				fn(s)
+				continue
+			}
+			walkJSONRefs(val, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkJSONRefs(item, fn)
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package oam
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// readLocal reads the file at path in the repo's working copy.
+func readLocal(r Repo, path string, validate bool) (*fetched, error) {
+	name := filepath.FromSlash(path)
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("outside %s", r.LocalPath)
+	}
+	name = filepath.Join(r.LocalPath, name)
+
+	start := time.Now()
+	u := localURL(name)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, &FetchError{URL: u, Err: err}
+	}
+	if validate {
+		if err := validateSpec(data); err != nil {
+			return nil, &FetchError{URL: u, Err: fmt.Errorf("invalid spec from %s: %w", u, err)}
+		}
+	}
+	return &fetched{Data: data, URL: u, Duration: time.Since(start)}, nil
+}
+
+// listLocal returns the slash-separated paths of all regular files in the
+// repo's working copy, skipping .git.
+func listLocal(repoName string, r Repo) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(r.LocalPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(r.LocalPath, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", repoName, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// localURL returns the file URL of name.
+func localURL(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	p := filepath.ToSlash(name)
+	if !strings.HasPrefix(p, "/") {
+		// A Windows drive letter.
+		p = "/" + p
+	}
+	return "file://" + p
+}
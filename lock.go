@@ -0,0 +1,194 @@
+package oam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Lock pins each repo's version to a commit and records the checksum of every
+// file fetched from it.
+type Lock struct {
+	Repos map[string]LockedRepo `yaml:"repos"`
+	// Files other than specs oam writes in the output directory, such as the
+	// manifest, slash-separated and relative to it; see AddGenerated.
+	Generated []string `yaml:"generated,omitempty"`
+}
+
+type LockedRepo struct {
+	URL     string       `yaml:"url"`
+	Version string       `yaml:"version"`          // Version as written in the config.
+	Commit  string       `yaml:"commit,omitempty"` // Commit SHA the version resolved to.
+	Path    []string     `yaml:"path,omitempty"`   // Path as written in the config.
+	Asset   string       `yaml:"asset,omitempty"`  // Asset as written in the config.
+	Files   []LockedFile `yaml:"files"`
+}
+
+type LockedFile struct {
+	Path   string `yaml:"path"`   // Path in the repo.
+	Output string `yaml:"output"` // Path of the written file, relative to the output directory.
+	SHA256 string `yaml:"sha256"` // Checksum of the written file.
+}
+
+// ReadLock reads the lock file at path. A missing file yields an empty lock.
+func ReadLock(path string) (Lock, error) {
+	lock := Lock{Repos: map[string]LockedRepo{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return lock, err
+	}
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return lock, fmt.Errorf("invalid lock file %s: %w", path, err)
+	}
+	if lock.Repos == nil {
+		lock.Repos = map[string]LockedRepo{}
+	}
+	return lock, nil
+}
+
+// WriteLock writes lock to the file at path.
+func WriteLock(path string, lock Lock) error {
+	data, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data, 0644)
+}
+
+// AddGenerated records the file at path, one oam writes besides the specs,
+// if it is in outputDir, so that Verify doesn't report it. An empty outputDir
+// is the default, ./oam.
+func (l *Lock) AddGenerated(outputDir, path string) {
+	if outputDir == "" {
+		outputDir = DefaultOutputDir
+	}
+	dir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || !filepath.IsLocal(rel) {
+		return
+	}
+	if rel = filepath.ToSlash(rel); !slices.Contains(l.Generated, rel) {
+		l.Generated = append(l.Generated, rel)
+		sort.Strings(l.Generated)
+	}
+}
+
+// pinVersion points the repo at the commit recorded in the fetcher's lock, or
+// resolves its version to a commit when there is no matching entry or Update
+// is set. Symbolic versions such as "latest" are resolved first.
+func (r *run) pinVersion(repoName string, repo Repo) (Repo, error) {
+	entry := LockedRepo{URL: repo.URL, Version: repo.Version, Path: repo.Path, Asset: repo.Asset}
+
+	if repo.LocalPath != "" {
+		// A working copy has no version to pin.
+	} else if old, ok := r.f.Lock.Repos[repoName]; ok && !r.f.Update && old.URL == repo.URL && old.Version == repo.Version {
+		entry.Commit = old.Commit
+	} else if repo.RefType == refCommit {
+		entry.Commit = repo.Version
+	} else {
+		var err error
+		if repo, err = r.f.resolveVersion(r.ctx, repoName, repo); err != nil {
+			return repo, err
+		}
+		if repo.provider() != providerGitHub {
+			// Only GitHub versions can be resolved to commits.
+		} else if _, err := repo.apiURL(); err != nil {
+			r.logger().Warn("not pinning version", "repo", repoName, "version", repo.Version, "err", err)
+		} else if entry.Commit, err = r.f.resolveCommit(r.ctx, repo); err != nil {
+			return repo, fmt.Errorf("%s: failed to resolve %s: %w", repoName, repo.Version, err)
+		}
+	}
+
+	repo.ref = repo.Version
+	if entry.Commit != "" {
+		repo.Version = entry.Commit
+	}
+
+	r.mu.Lock()
+	r.pinned[repoName] = entry
+	r.mu.Unlock()
+	return repo, nil
+}
+
+// skipUnchanged reports whether the repo can be skipped with OnlyChanged: its
+// url, version, path and asset match the lock and every file the lock lists
+// is still on disk as written. The skipped files are recorded as cached.
+func (r *run) skipUnchanged(repoName string, repo Repo) bool {
+	old, ok := r.f.Lock.Repos[repoName]
+	// A working copy may have changed without the config changing.
+	if !ok || repo.LocalPath != "" || r.f.Update || len(old.Files) == 0 || old.URL != repo.URL || old.Version != repo.Version ||
+		!slices.Equal(old.Path, repo.Path) || old.Asset != repo.Asset {
+		return false
+	}
+
+	results := make([]FileResult, 0, len(old.Files))
+	for _, file := range old.Files {
+		data, err := os.ReadFile(filepath.Join(r.outputDir, filepath.FromSlash(file.Output)))
+		if err != nil {
+			return false
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			return false
+		}
+		results = append(results, FileResult{Repo: repoName, Path: file.Path, Output: file.Output, SHA256: file.SHA256, Bytes: len(data), Cached: true})
+	}
+
+	r.logger().Info("unchanged since the last run, skipping", "repo", repoName, "files", len(results))
+	r.mu.Lock()
+	r.results = append(r.results, results...)
+	r.pinned[repoName] = old
+	r.mu.Unlock()
+	return true
+}
+
+// lock builds the lock for this run from the pinned repos and written files.
+// Repos that failed keep their previous entry, and files are sorted so the
+// lock is stable across runs.
+func (r *run) lock() Lock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock := Lock{Repos: map[string]LockedRepo{}}
+	for name, entry := range r.f.Lock.Repos {
+		lock.Repos[name] = entry
+	}
+
+	failed := map[string]bool{}
+	files := map[string][]LockedFile{}
+	for _, res := range r.results {
+		if res.Err != nil {
+			failed[res.Repo] = true
+			continue
+		}
+		files[res.Repo] = append(files[res.Repo], LockedFile{Path: res.Path, Output: res.Output, SHA256: res.SHA256})
+	}
+
+	for name, entry := range r.pinned {
+		if failed[name] {
+			continue
+		}
+		entry.Files = files[name]
+		sort.Slice(entry.Files, func(i, j int) bool { return entry.Files[i].Path < entry.Files[j].Path })
+		lock.Repos[name] = entry
+	}
+	return lock
+}
@@ -0,0 +1,65 @@
+package oam
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// manifest is the JSON form of a Result written by WriteManifest.
+type manifest struct {
+	OutputDir string          `json:"output_dir"`
+	Files     []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Repo        string `json:"repo"`
+	Path        string `json:"path"`
+	URL         string `json:"url,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	Output      string `json:"output,omitempty"`
+	Bytes       int    `json:"bytes"`
+	SHA256      string `json:"sha256,omitempty"`
+	SpecVersion string `json:"spec_version,omitempty"`
+	Cached      bool   `json:"cached"`
+	DurationMS  int64  `json:"duration_ms"`
+	Error       string `json:"error,omitempty"`
+	Abandoned   bool   `json:"abandoned,omitempty"`
+}
+
+// WriteManifest writes a JSON summary of the run to path, with one entry per
+// file sorted by repo and path.
+func (r *Result) WriteManifest(path string) error {
+	m := manifest{OutputDir: r.OutputDir, Files: []manifestEntry{}}
+	for _, f := range r.Files {
+		e := manifestEntry{
+			Repo:        f.Repo,
+			Path:        f.Path,
+			URL:         f.URL,
+			Status:      f.Status,
+			Output:      f.Output,
+			Bytes:       f.Bytes,
+			SHA256:      f.SHA256,
+			SpecVersion: f.SpecVersion,
+			Cached:      f.Cached,
+			DurationMS:  f.Duration.Milliseconds(),
+			Abandoned:   f.Abandoned,
+		}
+		if f.Err != nil {
+			e.Error = f.Err.Error()
+		}
+		m.Files = append(m.Files, e)
+	}
+	sort.SliceStable(m.Files, func(i, j int) bool {
+		a, b := m.Files[i], m.Files[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Path < b.Path
+	})
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,77 @@
+package oam
+
+import (
+	"container/list"
+	"sync"
+)
+
+const defaultCacheMaxBytes = 256 << 20
+
+func (f *Fetcher) cacheMaxBytes() int64 {
+	if f.CacheMaxBytes > 0 {
+		return f.CacheMaxBytes
+	}
+	return defaultCacheMaxBytes
+}
+
+// memoryCache holds fetched files by URL, evicting the least recently used
+// once their bodies add up to more than the limit. Entries are shared, so
+// their data must not be modified. The zero value is an empty cache.
+type memoryCache struct {
+	mu    sync.Mutex
+	size  int64                    // Total length of the cached bodies.
+	order *list.List               // Elements holding *memoryCacheEntry, most recently used first.
+	items map[string]*list.Element // Elements of order, keyed by URL.
+}
+
+type memoryCacheEntry struct {
+	url  string
+	file *fetched
+}
+
+// load returns the file cached for url, marking it as recently used.
+func (c *memoryCache) load(url string) (*fetched, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[url]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*memoryCacheEntry).file, true
+}
+
+// store caches file for url, then evicts the least recently used files until
+// the bodies fit in max bytes. A file larger than max is not cached at all.
+func (c *memoryCache) store(url string, file *fetched, max int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items == nil {
+		c.items = map[string]*list.Element{}
+		c.order = list.New()
+	}
+	if el, ok := c.items[url]; ok {
+		c.remove(el)
+	}
+	if int64(len(file.Data)) > max {
+		return
+	}
+	c.items[url] = c.order.PushFront(&memoryCacheEntry{url: url, file: file})
+	c.size += int64(len(file.Data))
+	for c.size > max {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *memoryCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*memoryCacheEntry)
+	delete(c.items, e.url)
+	c.size -= int64(len(e.file.Data))
+}
+
+// reset empties the cache.
+func (c *memoryCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items, c.order, c.size = nil, nil, 0
+}
@@ -0,0 +1,54 @@
+package oam
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	f := &Fetcher{CacheMaxBytes: 30}
+	var c memoryCache
+	file := func(n int) *fetched { return &fetched{Data: []byte(strings.Repeat("x", n))} }
+
+	c.store("a", file(10), f.cacheMaxBytes())
+	c.store("b", file(10), f.cacheMaxBytes())
+	c.store("c", file(10), f.cacheMaxBytes())
+	// Reading a makes b the least recently used.
+	if _, ok := c.load("a"); !ok {
+		t.Fatal("a not cached")
+	}
+	c.store("d", file(10), f.cacheMaxBytes())
+
+	if _, ok := c.load("b"); ok {
+		t.Error("b, the least recently used, was not evicted")
+	}
+	for _, url := range []string{"a", "c", "d"} {
+		if _, ok := c.load(url); !ok {
+			t.Errorf("%s was evicted", url)
+		}
+	}
+	if c.size != 30 {
+		t.Errorf("size = %d, want 30", c.size)
+	}
+
+	// A file larger than the limit is not cached, and evicts nothing.
+	c.store("big", file(31), f.cacheMaxBytes())
+	if _, ok := c.load("big"); ok {
+		t.Error("file larger than the limit was cached")
+	}
+	if _, ok := c.load("a"); !ok {
+		t.Error("a was evicted by a file too large to cache")
+	}
+}
+
+func TestMemoryCacheReplacesEntry(t *testing.T) {
+	var c memoryCache
+	c.store("a", &fetched{Data: []byte("old contents")}, 100)
+	c.store("a", &fetched{Data: []byte("new")}, 100)
+	if got, ok := c.load("a"); !ok || string(got.Data) != "new" {
+		t.Errorf("load(a) = %v, %v, want new", got, ok)
+	}
+	if c.size != 3 {
+		t.Errorf("size = %d, want 3", c.size)
+	}
+}
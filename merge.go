@@ -0,0 +1,406 @@
+package oam
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// mergeSource is a spec being merged, with the prefix for its names.
+type mergeSource struct {
+	name   string // Repo and path, for messages.
+	prefix string
+	doc    yaml.MapSlice
+}
+
+// WriteMerged combines the fetched OpenAPI 3 specs into a single spec written
+// to file, as JSON if its name ends in .json and YAML otherwise.
+//
+// Paths are concatenated; a path defined by more than one spec is an error.
+// Component names and operationIds are prefixed with the repo name, or with
+// the repo name and the file's base name for repos with several specs, to keep
+// them apart, and so are the names of tags defined differently by an earlier
+// spec. Each spec's servers and security requirements are moved into its
+// paths and operations so they still apply.
+func (r *Result) WriteMerged(file string) error {
+	return r.writeMerged(file, false)
+}
+
+// WriteMergedStrict is WriteMerged without the prefixes: components, security
+// schemes, tags and operationIds keep their names, and one defined
+// differently by two specs is an error describing each such conflict with a
+// diff. Identical definitions are merged.
+func (r *Result) WriteMergedStrict(file string) error {
+	return r.writeMerged(file, true)
+}
+
+func (r *Result) writeMerged(file string, strict bool) error {
+	sources, err := r.mergeSources()
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return errors.New("no OpenAPI specs to merge")
+	}
+	doc, err := mergeSpecs(sources, strict)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		if data, err = yamlToJSON(data); err != nil {
+			return err
+		}
+	}
+	return writeAtomic(file, data, 0644)
+}
+
+// mergeSources reads the written specs, sorted by repo and path.
+func (r *Result) mergeSources() ([]mergeSource, error) {
+	var files []FileResult
+	specs := map[string]int{}
+	for _, f := range r.Files {
+		if f.Err == nil && f.SpecVersion != "" {
+			files = append(files, f)
+			specs[f.Repo]++
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Repo != files[j].Repo {
+			return files[i].Repo < files[j].Repo
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	sources := make([]mergeSource, 0, len(files))
+	for _, f := range files {
+		if !strings.HasPrefix(f.SpecVersion, "OpenAPI 3.") {
+			return nil, fmt.Errorf("%s: cannot merge %s specs, only OpenAPI 3", f.Repo, f.SpecVersion)
+		}
+		data, err := os.ReadFile(filepath.Join(r.OutputDir, filepath.FromSlash(f.Output)))
+		if err != nil {
+			return nil, err
+		}
+		var doc yaml.MapSlice
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: failed to parse %s: %w", f.Repo, f.Output, err)
+		}
+		prefix := f.Repo
+		if specs[f.Repo] > 1 {
+			prefix += "_" + trimExt(path.Base(f.Path))
+		}
+		sources = append(sources, mergeSource{
+			name:   f.Repo + "/" + f.Path,
+			prefix: invalidComponentChars.ReplaceAllString(prefix, "_"),
+			doc:    doc,
+		})
+	}
+	return sources, nil
+}
+
+func mergeSpecs(sources []mergeSource, strict bool) (yaml.MapSlice, error) {
+	version := fmt.Sprint(mapGet(sources[0].doc, "openapi"))
+	names := make([]string, len(sources))
+	for i, s := range sources {
+		names[i] = s.name
+		if v := fmt.Sprint(mapGet(s.doc, "openapi")); minorVersion(v) != minorVersion(version) {
+			return nil, fmt.Errorf("cannot merge OpenAPI %s (%s) with OpenAPI %s (%s)", version, sources[0].name, v, s.name)
+		}
+	}
+
+	var problems []string
+	paths := yaml.MapSlice{}
+	webhooks := yaml.MapSlice{}
+	components := yaml.MapSlice{}
+	var tags []interface{}
+	pathOwner := map[string]string{}
+	webhookOwner := map[string]string{}
+	componentOwner := map[string]string{} // By section and name, e.g. schemas/Pet.
+	operationOwner := map[string]string{}
+	tagOwner := map[string]string{}
+	tagIndex := map[string]int{}
+	for _, s := range sources {
+		doc := deepCopy(s.doc).(yaml.MapSlice)
+		if !strict {
+			doc = prefixSpec(s)
+		}
+		servers := mapGet(doc, "servers")
+		security := mapGet(doc, "security")
+
+		docTags, _ := mapGet(doc, "tags").([]interface{})
+		renamed := map[string]string{}
+		for _, tag := range docTags {
+			name := fmt.Sprint(mapGet(asMap(tag), "name"))
+			if owner, ok := tagOwner[name]; ok {
+				same, c := conflict("tag "+name, owner, s.name, tags[tagIndex[name]], tag)
+				if same {
+					continue
+				}
+				if strict {
+					problems = append(problems, c)
+					continue
+				}
+				// Keep this spec's operations apart from the other's.
+				renamed[name] = s.prefix + "_" + name
+				name = renamed[name]
+				tag = mapSet(asMap(tag), "name", name)
+			}
+			tagOwner[name] = s.name
+			tagIndex[name] = len(tags)
+			tags = append(tags, tag)
+		}
+		if len(renamed) > 0 {
+			renameTags(mapGet(doc, "paths"), renamed)
+			renameTags(mapGet(doc, "webhooks"), renamed)
+		}
+
+		pathItems, _ := mapGet(doc, "paths").(yaml.MapSlice)
+		for _, item := range pathItems {
+			p := fmt.Sprint(item.Key)
+			if !strings.HasPrefix(p, "/") {
+				continue // An extension.
+			}
+			if owner, ok := pathOwner[p]; ok {
+				problems = append(problems, fmt.Sprintf("path %s is in both %s and %s", p, owner, s.name))
+				continue
+			}
+			pathOwner[p] = s.name
+			paths = append(paths, yaml.MapItem{Key: p, Value: moveRootSettings(item.Value, servers, security)})
+		}
+
+		hooks, _ := mapGet(doc, "webhooks").(yaml.MapSlice)
+		for _, item := range hooks {
+			k := fmt.Sprint(item.Key)
+			if owner, ok := webhookOwner[k]; ok {
+				problems = append(problems, fmt.Sprintf("webhook %s is in both %s and %s", k, owner, s.name))
+				continue
+			}
+			webhookOwner[k] = s.name
+			webhooks = append(webhooks, yaml.MapItem{Key: k, Value: moveRootSettings(item.Value, nil, security)})
+		}
+
+		if strict {
+			for _, items := range []yaml.MapSlice{pathItems, hooks} {
+				for _, id := range operationIDs(items) {
+					if owner, ok := operationOwner[id]; ok {
+						problems = append(problems, fmt.Sprintf("operationId %s is in both %s and %s", id, owner, s.name))
+						continue
+					}
+					operationOwner[id] = s.name
+				}
+			}
+		}
+
+		comps, _ := mapGet(doc, "components").(yaml.MapSlice)
+		for _, sec := range comps {
+			defs, ok := sec.Value.(yaml.MapSlice)
+			if !ok {
+				continue
+			}
+			key := fmt.Sprint(sec.Key)
+			merged, _ := mapGet(components, key).(yaml.MapSlice)
+			for _, def := range defs {
+				name := fmt.Sprint(def.Key)
+				if owner, ok := componentOwner[key+"/"+name]; ok {
+					if same, c := conflict("components."+key+"."+name, owner, s.name, mapGet(merged, name), def.Value); !same {
+						problems = append(problems, c)
+					}
+					continue
+				}
+				componentOwner[key+"/"+name] = s.name
+				merged = append(merged, def)
+			}
+			components = mapSet(components, key, merged)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("conflicting definitions:\n%s", strings.Join(problems, "\n"))
+	}
+
+	doc := yaml.MapSlice{
+		{Key: "openapi", Value: version},
+		{Key: "info", Value: yaml.MapSlice{
+			{Key: "title", Value: "Merged API"},
+			{Key: "description", Value: "Merged from " + strings.Join(names, ", ") + "."},
+			{Key: "version", Value: "1.0.0"},
+		}},
+	}
+	if len(tags) > 0 {
+		doc = append(doc, yaml.MapItem{Key: "tags", Value: tags})
+	}
+	doc = append(doc, yaml.MapItem{Key: "paths", Value: paths})
+	if len(webhooks) > 0 {
+		doc = append(doc, yaml.MapItem{Key: "webhooks", Value: webhooks})
+	}
+	if len(components) > 0 {
+		doc = append(doc, yaml.MapItem{Key: "components", Value: components})
+	}
+	return doc, nil
+}
+
+// maxConflictLines is the most lines of diff shown for a conflict.
+const maxConflictLines = 20
+
+// conflict reports whether a and b, the definitions of what in the specs
+// aName and bName, are the same, and describes the difference when not.
+func conflict(what, aName, bName string, a, b interface{}) (bool, string) {
+	var data [2][]byte
+	for i, v := range []interface{}{a, b} {
+		d, err := yaml.Marshal(sortMapKeys(v))
+		if err != nil {
+			return false, fmt.Sprintf("%s differs between %s and %s", what, aName, bName)
+		}
+		data[i] = d
+	}
+	if same, err := sameContent(data[0], data[1]); err == nil && same {
+		return true, ""
+	}
+
+	lines := strings.Split(strings.TrimSuffix(unifiedDiff(aName, bName, data[0], data[1]), "\n"), "\n")
+	if len(lines) > maxConflictLines {
+		lines = append(lines[:maxConflictLines], fmt.Sprintf("(%d more lines)", len(lines)-maxConflictLines))
+	}
+	return false, fmt.Sprintf("%s differs between %s and %s:\n    %s", what, aName, bName, strings.Join(lines, "\n    "))
+}
+
+// operationIDs returns the operationIds of the operations in path items.
+func operationIDs(items yaml.MapSlice) []string {
+	var ids []string
+	for _, item := range items {
+		for _, field := range asMap(item.Value) {
+			if !operationKeys[fmt.Sprint(field.Key)] {
+				continue
+			}
+			if id, ok := mapGet(asMap(field.Value), "operationId").(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// renameTags renames the tags of the operations in path items.
+func renameTags(items interface{}, renamed map[string]string) {
+	for _, item := range asMap(items) {
+		for _, field := range asMap(item.Value) {
+			if !operationKeys[fmt.Sprint(field.Key)] {
+				continue
+			}
+			opTags, _ := mapGet(asMap(field.Value), "tags").([]interface{})
+			for i, tag := range opTags {
+				if name, ok := renamed[fmt.Sprint(tag)]; ok {
+					opTags[i] = name
+				}
+			}
+		}
+	}
+}
+
+// minorVersion returns the major and minor parts of a version, e.g. 3.1.
+func minorVersion(v string) string {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return v
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func asMap(v interface{}) yaml.MapSlice {
+	m, _ := v.(yaml.MapSlice)
+	return m
+}
+
+// prefixSpec returns the spec with its component names, and the references
+// to them, and its operationIds prefixed.
+func prefixSpec(s mergeSource) yaml.MapSlice {
+	doc := deepCopy(s.doc).(yaml.MapSlice)
+	comps, _ := mapGet(doc, "components").(yaml.MapSlice)
+	for _, sec := range comps {
+		defs, _ := sec.Value.(yaml.MapSlice)
+		for i := range defs {
+			defs[i].Key = s.prefix + "_" + fmt.Sprint(defs[i].Key)
+		}
+	}
+	prefixRefs(doc, s.prefix, "")
+	return doc
+}
+
+// prefixRefs rewrites the internal component references, security
+// requirements and operationIds in v. parent is the key v is the value of.
+func prefixRefs(v interface{}, prefix, parent string) {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for i, item := range v {
+			key := fmt.Sprint(item.Key)
+			if s, ok := item.Value.(string); ok {
+				switch {
+				case key == "$ref" || parent == "mapping":
+					v[i].Value = prefixRef(s, prefix)
+				case key == "operationId":
+					v[i].Value = prefix + "_" + s
+				}
+				continue
+			}
+			if reqs, ok := item.Value.([]interface{}); ok && key == "security" {
+				for _, req := range reqs {
+					m := asMap(req)
+					for j := range m {
+						m[j].Key = prefix + "_" + fmt.Sprint(m[j].Key)
+					}
+				}
+				continue
+			}
+			prefixRefs(item.Value, prefix, key)
+		}
+	case []interface{}:
+		for _, item := range v {
+			prefixRefs(item, prefix, "")
+		}
+	}
+}
+
+// prefixRef prefixes the component name in a #/components/<section>/<name> ref.
+func prefixRef(ref, prefix string) string {
+	const root = "#/components/"
+	rest, ok := strings.CutPrefix(ref, root)
+	if !ok {
+		return ref
+	}
+	section, name, ok := strings.Cut(rest, "/")
+	if !ok {
+		return ref
+	}
+	return root + section + "/" + prefix + "_" + name
+}
+
+// moveRootSettings applies a spec's root servers and security to a path item
+// that doesn't set its own.
+func moveRootSettings(v, servers, security interface{}) interface{} {
+	item, ok := v.(yaml.MapSlice)
+	if !ok {
+		return v
+	}
+	if servers != nil && mapGet(item, "servers") == nil {
+		item = append(item, yaml.MapItem{Key: "servers", Value: servers})
+	}
+	if security == nil {
+		return item
+	}
+	for i, field := range item {
+		op, ok := field.Value.(yaml.MapSlice)
+		if ok && operationKeys[fmt.Sprint(field.Key)] && mapGet(op, "security") == nil {
+			item[i].Value = append(op, yaml.MapItem{Key: "security", Value: security})
+		}
+	}
+	return item
+}
@@ -0,0 +1,113 @@
+package oam
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Netrc holds credentials from a .netrc file, by machine name. Credentials
+// from a default entry are stored under the empty name.
+type Netrc map[string]NetrcMachine
+
+// NetrcMachine is a login and password from a .netrc file.
+type NetrcMachine struct {
+	Login    string
+	Password string
+}
+
+// DefaultNetrcPath returns the path of the .netrc file: $NETRC if set,
+// otherwise .netrc in the home directory.
+func DefaultNetrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// ReadNetrc parses the .netrc file at path. A missing file yields no entries.
+func ReadNetrc(path string) (Netrc, error) {
+	n := Netrc{}
+	if path == "" {
+		return n, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return n, nil
+	}
+	if err != nil {
+		return n, err
+	}
+
+	var name string
+	var m NetrcMachine
+	have := false
+	flush := func() {
+		if have {
+			if _, ok := n[name]; !ok {
+				n[name] = m
+			}
+		}
+		name, m, have = "", NetrcMachine{}, false
+	}
+
+	lines := bufio.NewScanner(strings.NewReader(string(data)))
+	inMacro := false
+	for lines.Scan() {
+		line := lines.Text()
+		if inMacro {
+			// A macro definition ends at the first blank line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			value := ""
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+			switch fields[i] {
+			case "machine":
+				flush()
+				name, have = value, true
+				i++
+			case "default":
+				flush()
+				have = true
+			case "login":
+				m.Login = value
+				i++
+			case "password":
+				m.Password = value
+				i++
+			case "account":
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	flush()
+	return n, lines.Err()
+}
+
+// lookup returns the credentials for host, falling back to the default entry.
+func (n Netrc) lookup(host string) (NetrcMachine, bool) {
+	if m, ok := n[host]; ok {
+		return m, true
+	}
+	m, ok := n[""]
+	return m, ok
+}
@@ -0,0 +1,90 @@
+package oam
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// orderedLog is a slog handler that holds back the records of each repo, as
+// named by their repo attribute, until every repo before it by name has
+// finished. A repo's records are then written sorted by their path attribute.
+// Fetches still run concurrently, but the log of an ordered run reads the same
+// each time. Records without a repo pass straight through.
+type orderedLog struct {
+	inner slog.Handler
+
+	mu      sync.Mutex
+	order   []string                 // Repo names, sorted.
+	next    int                      // Index in order of the first repo not yet flushed.
+	done    map[string]bool          // Repos that have finished.
+	records map[string][]slog.Record // Held back records of the repos not yet flushed.
+}
+
+func newOrderedLog(inner slog.Handler, names []string) *orderedLog {
+	l := &orderedLog{inner: inner, order: names, done: map[string]bool{}, records: map[string][]slog.Record{}}
+	for _, name := range names {
+		l.records[name] = nil
+	}
+	return l
+}
+
+func (l *orderedLog) Enabled(ctx context.Context, level slog.Level) bool {
+	return l.inner.Enabled(ctx, level)
+}
+
+func (l *orderedLog) Handle(ctx context.Context, rec slog.Record) error {
+	repo := recordAttr(rec, "repo")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if held, ok := l.records[repo]; ok {
+		l.records[repo] = append(held, rec.Clone())
+		return nil
+	}
+	return l.inner.Handle(ctx, rec)
+}
+
+// WithAttrs and WithGroup return handlers that don't hold records back.
+func (l *orderedLog) WithAttrs(attrs []slog.Attr) slog.Handler { return l.inner.WithAttrs(attrs) }
+func (l *orderedLog) WithGroup(name string) slog.Handler       { return l.inner.WithGroup(name) }
+
+// finish marks a repo as finished, writing out the records of every repo
+// whose turn has come.
+func (l *orderedLog) finish(repo string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done[repo] = true
+	for l.next < len(l.order) && l.done[l.order[l.next]] {
+		name := l.order[l.next]
+		records := l.records[name]
+		sort.SliceStable(records, func(i, j int) bool {
+			return recordAttr(records[i], "path") < recordAttr(records[j], "path")
+		})
+		for _, rec := range records {
+			l.inner.Handle(context.Background(), rec)
+		}
+		delete(l.records, name)
+		l.next++
+	}
+}
+
+// close writes out everything still held back, in order.
+func (l *orderedLog) close() {
+	for _, name := range l.order {
+		l.finish(name)
+	}
+}
+
+func recordAttr(rec slog.Record, key string) string {
+	var v string
+	rec.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			v = a.Value.String()
+			return false
+		}
+		return true
+	})
+	return v
+}
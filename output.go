@@ -0,0 +1,94 @@
+package oam
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// OutputName is the data an output template is executed with.
+type OutputName struct {
+	RepoName string // Repo name, the key in the config.
+	Version  string // Version as configured, or the tag it resolved to, never the pinned commit.
+	Path     string // Path of the file in the repo.
+	Base     string // Base name of Path without its extension.
+	Name     string // Default file name: the repo name, or derived from the path for multiple paths and globs.
+	Ext      string // Output extension without the dot: yaml or json.
+}
+
+// ParseOutputTemplate parses an output file name template, such as
+// "{{.RepoName}}-{{.Version}}.{{.Ext}}", and checks it executes. The result
+// is a slash-separated path relative to the output directory.
+func ParseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %w", err)
+	}
+	sample := OutputName{RepoName: "repo", Version: "v1.0.0", Path: "openapi.yaml", Base: "openapi", Name: "repo", Ext: formatYAML}
+	if err := tmpl.Execute(new(strings.Builder), sample); err != nil {
+		return nil, fmt.Errorf("invalid output template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// relFile returns the output file of the target, relative to the output
+// directory. Without an output template it is {repo}/{name}.{ext}, or
+// {repo}/{path}.{ext} with PreservePaths.
+func (f *Fetcher) relFile(t target) (string, error) {
+	if t.Repo.Output != "" {
+		return filepath.FromSlash(path.Clean(t.Repo.Output)), nil
+	}
+
+	ext := f.outputFormat(t)
+	if f.OutputTemplate == nil {
+		dest := t.Dest
+		if f.PreservePaths {
+			dest = trimExt(path.Clean("/" + t.Path))[1:]
+		}
+		return filepath.Join(t.Name, filepath.FromSlash(dest)+"."+ext), nil
+	}
+
+	version := t.Repo.Version
+	if t.Repo.ref != "" {
+		version = t.Repo.ref
+	}
+	var b strings.Builder
+	err := f.OutputTemplate.Execute(&b, OutputName{
+		RepoName: t.Name,
+		Version:  version,
+		Path:     t.Path,
+		Base:     trimExt(path.Base(t.Path)),
+		Name:     t.Dest,
+		Ext:      ext,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	name := path.Clean(b.String())
+	if b.Len() == 0 || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("output template gives %q, which is not inside the output directory", b.String())
+	}
+	return filepath.FromSlash(name), nil
+}
+
+// checkOutputDir creates the output directory if needed and checks a file can
+// be written to it, so a run fails up front rather than once per file.
+func checkOutputDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return fmt.Errorf("cannot create output directory %s: %w", abs, err)
+	}
+	probe, err := os.CreateTemp(abs, ".oam-check-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", abs, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
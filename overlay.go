@@ -0,0 +1,343 @@
+package oam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// overlayAction is an action of an OpenAPI Overlay document: an update merged
+// into, or the removal of, the nodes its JSONPath target selects.
+type overlayAction struct {
+	target string
+	path   []jsonPathSegment
+	update interface{}
+	remove bool
+}
+
+// readOverlay reads the actions of the Overlay document at name.
+func readOverlay(name string) ([]overlayAction, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if _, ok := mapLookup(doc, "overlay"); !ok {
+		return nil, fmt.Errorf("%s is not an overlay document: no overlay version", name)
+	}
+	items, _ := mapGet(doc, "actions").([]interface{})
+	actions := make([]overlayAction, 0, len(items))
+	for i, item := range items {
+		m, _ := item.(yaml.MapSlice)
+		target, _ := mapGet(m, "target").(string)
+		if target == "" {
+			return nil, fmt.Errorf("%s: action %d has no target", name, i+1)
+		}
+		path, err := parseJSONPath(target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: action %d: %w", name, i+1, err)
+		}
+		remove, _ := mapGet(m, "remove").(bool)
+		update, hasUpdate := mapLookup(m, "update")
+		if !remove && !hasUpdate {
+			return nil, fmt.Errorf("%s: action %d has neither update nor remove", name, i+1)
+		}
+		if remove && len(path) == 0 {
+			return nil, fmt.Errorf("%s: action %d removes the whole document", name, i+1)
+		}
+		actions = append(actions, overlayAction{target: target, path: path, update: update, remove: remove})
+	}
+	return actions, nil
+}
+
+// overlayPath returns the path of the repo's overlay document, resolving a
+// relative one against the directory of the config file the repo is in, as
+// includes are.
+func (r Repo) overlayPath() string {
+	if r.Overlay == "" || filepath.IsAbs(r.Overlay) {
+		return r.Overlay
+	}
+	return filepath.Join(r.dir, r.Overlay)
+}
+
+// overlay applies the repo's overlay document to the spec, logging how many
+// of its actions matched. With overlay_strict an action matching nothing
+// fails the spec.
+func (r *run) overlay(t target, data []byte) ([]byte, error) {
+	actions, err := readOverlay(t.Repo.overlayPath())
+	if err != nil {
+		return nil, fmt.Errorf("overlay: %w", err)
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+
+	root := &jsonPathNode{
+		get: func() interface{} { return doc },
+		set: func(v interface{}) { doc, _ = v.(yaml.MapSlice) },
+	}
+	matched := 0
+	var unmatched []string
+	for _, a := range actions {
+		nodes := root.selectPath(a.path)
+		if len(nodes) == 0 {
+			unmatched = append(unmatched, a.target)
+			r.logger().Warn("overlay action matched nothing", "repo", t.Name, "path", t.Path, "target", a.target)
+			continue
+		}
+		matched++
+		if a.remove {
+			// Later siblings first, so the indices of earlier ones hold.
+			for i := len(nodes) - 1; i >= 0; i-- {
+				nodes[i].remove()
+			}
+			continue
+		}
+		for _, n := range nodes {
+			n.set(applyUpdate(n.get(), deepCopy(a.update)))
+		}
+	}
+	r.logger().Info("applied overlay", "repo", t.Name, "path", t.Path, "overlay", t.Repo.Overlay, "actions", len(actions), "matched", matched)
+	if t.Repo.OverlayStrict && len(unmatched) > 0 {
+		return nil, fmt.Errorf("overlay %s: no match for %s", t.Repo.Overlay, strings.Join(unmatched, ", "))
+	}
+	if matched == 0 {
+		return data, nil
+	}
+	return yaml.Marshal(doc)
+}
+
+// applyUpdate returns target with update applied: objects are merged, arrays
+// have update appended, and anything else is replaced.
+func applyUpdate(target, update interface{}) interface{} {
+	switch t := target.(type) {
+	case []interface{}:
+		if items, ok := update.([]interface{}); ok {
+			return append(t, items...)
+		}
+		return append(t, update)
+	case yaml.MapSlice:
+		u, ok := update.(yaml.MapSlice)
+		if !ok {
+			return update
+		}
+		for _, item := range u {
+			key := fmt.Sprint(item.Key)
+			old, ok := mapLookup(t, key)
+			if _, isMap := old.(yaml.MapSlice); ok && isMap {
+				t = mapSet(t, key, applyUpdate(old, item.Value))
+			} else {
+				t = mapSet(t, key, item.Value)
+			}
+		}
+		return t
+	default:
+		return update
+	}
+}
+
+// jsonPathSegment is a step of a JSONPath: a member name, an array index or a
+// wildcard, optionally applied to all descendants (..).
+type jsonPathSegment struct {
+	name      string
+	index     int // -1 unless the segment is an index.
+	wildcard  bool
+	recursive bool
+}
+
+// parseJSONPath parses the subset of JSONPath overlays commonly use: $, .name,
+// ['name'], [n], * and [*], and .. recursive descent. Filter expressions are
+// not supported.
+func parseJSONPath(expr string) ([]jsonPathSegment, error) {
+	rest, ok := strings.CutPrefix(expr, "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath %q must start with $", expr)
+	}
+	var segs []jsonPathSegment
+	for rest != "" {
+		seg := jsonPathSegment{index: -1}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			seg.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			seg.name, rest = rest[:end], rest[end:]
+			if seg.name == "" {
+				return nil, fmt.Errorf("JSONPath %q has an empty member name", expr)
+			}
+			seg.wildcard = seg.name == "*"
+			segs = append(segs, seg)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("invalid JSONPath %q at %q", expr, rest)
+		}
+
+		end := closingBracket(rest)
+		if end < 0 {
+			return nil, fmt.Errorf("JSONPath %q has an unclosed [", expr)
+		}
+		sel := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case sel == "*":
+			seg.wildcard = true
+		case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+			seg.name = strings.ReplaceAll(sel[1:len(sel)-1], `\`+sel[:1], sel[:1])
+		case strings.HasPrefix(sel, "?"):
+			return nil, fmt.Errorf("JSONPath %q: filter expressions are not supported", expr)
+		default:
+			i, err := strconv.Atoi(sel)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("JSONPath %q: invalid selector [%s]", expr, sel)
+			}
+			seg.index = i
+		}
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+// closingBracket returns the index of the ] closing the [ s starts with,
+// skipping quoted names, or -1.
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonPathNode is a value in a decoded document, read and replaced through
+// its parent so nodes stay valid as their parents change.
+type jsonPathNode struct {
+	get    func() interface{}
+	set    func(interface{})
+	remove func()
+}
+
+// selectPath returns the nodes below n that path selects, in document order.
+func (n *jsonPathNode) selectPath(path []jsonPathSegment) []*jsonPathNode {
+	nodes := []*jsonPathNode{n}
+	for _, seg := range path {
+		var next []*jsonPathNode
+		for _, node := range nodes {
+			if seg.recursive {
+				for _, d := range node.descendants() {
+					next = append(next, d.children(seg)...)
+				}
+			} else {
+				next = append(next, node.children(seg)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// descendants returns n and every node below it.
+func (n *jsonPathNode) descendants() []*jsonPathNode {
+	nodes := []*jsonPathNode{n}
+	for _, c := range n.children(jsonPathSegment{index: -1, wildcard: true}) {
+		nodes = append(nodes, c.descendants()...)
+	}
+	return nodes
+}
+
+// children returns the members or items of n that seg selects.
+func (n *jsonPathNode) children(seg jsonPathSegment) []*jsonPathNode {
+	var nodes []*jsonPathNode
+	switch v := n.get().(type) {
+	case yaml.MapSlice:
+		if seg.index >= 0 {
+			return nil
+		}
+		for _, item := range v {
+			if key := fmt.Sprint(item.Key); seg.wildcard || key == seg.name {
+				nodes = append(nodes, n.member(key))
+			}
+		}
+	case []interface{}:
+		if seg.wildcard {
+			for i := range v {
+				nodes = append(nodes, n.item(i))
+			}
+		} else if seg.index >= 0 && seg.index < len(v) {
+			nodes = append(nodes, n.item(seg.index))
+		}
+	}
+	return nodes
+}
+
+func (n *jsonPathNode) member(key string) *jsonPathNode {
+	parent := func() yaml.MapSlice {
+		m, _ := n.get().(yaml.MapSlice)
+		return m
+	}
+	return &jsonPathNode{
+		get: func() interface{} { return mapGet(parent(), key) },
+		set: func(v interface{}) { n.set(mapSet(parent(), key, v)) },
+		remove: func() {
+			m := parent()
+			kept := make(yaml.MapSlice, 0, len(m))
+			for _, item := range m {
+				if fmt.Sprint(item.Key) != key {
+					kept = append(kept, item)
+				}
+			}
+			n.set(kept)
+		},
+	}
+}
+
+func (n *jsonPathNode) item(i int) *jsonPathNode {
+	parent := func() []interface{} {
+		items, _ := n.get().([]interface{})
+		return items
+	}
+	return &jsonPathNode{
+		get: func() interface{} {
+			if items := parent(); i < len(items) {
+				return items[i]
+			}
+			return nil
+		},
+		set: func(v interface{}) {
+			if items := parent(); i < len(items) {
+				items[i] = v
+			}
+		},
+		remove: func() {
+			if items := parent(); i < len(items) {
+				n.set(append(items[:i:i], items[i+1:]...))
+			}
+		},
+	}
+}
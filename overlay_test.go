@@ -0,0 +1,51 @@
+package oam
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverlayRelativeToConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, testSpec)
+	}))
+	defer srv.Close()
+
+	// configs/oam.yaml includes teams/users.yaml, each with an overlay next
+	// to it, and neither is in the current directory.
+	dir := t.TempDir()
+	write := func(name, data string) {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("configs/oam.yaml", "include: [teams/users.yaml]\nrepos:\n  pets: {url: o/pets, version: main, path: openapi.yaml, overlay: pets.overlay.yaml}\n")
+	write("configs/pets.overlay.yaml", "overlay: 1.0.0\nactions:\n- target: $.info\n  update: {title: Pets overlaid}\n")
+	write("configs/teams/users.yaml", "repos:\n  users: {url: o/users, version: main, path: openapi.yaml, overlay: overlays/users.yaml}\n")
+	write("configs/teams/overlays/users.yaml", "overlay: 1.0.0\nactions:\n- target: $.info\n  update: {title: Users overlaid}\n")
+
+	config, err := ReadConfig(filepath.Join(dir, "configs", "oam.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.OutputDir, config.BaseURL = t.TempDir(), srv.URL
+	result, err := testFetcher().Run(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for repo, title := range map[string]string{"pets": "Pets overlaid", "users": "Users overlaid"} {
+		if got := string(readOutput(t, result, repo)); !strings.Contains(got, title) {
+			t.Errorf("%s = %q, want the title %q", repo, got, title)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package oam
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+type partFileKey struct{}
+
+// withPartFile returns a context whose download of a spec is kept in the file
+// name while in progress, so that a later run can resume it.
+func withPartFile(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, partFileKey{}, name)
+}
+
+// partFileFrom returns the file the download with ctx is kept in, if any.
+func partFileFrom(ctx context.Context) string {
+	name, _ := ctx.Value(partFileKey{}).(string)
+	return name
+}
+
+// partMeta describes the response a partial download is from, stored next to
+// it in name.json.
+type partMeta struct {
+	URL       string `json:"url"`
+	Validator string `json:"validator"` // ETag or Last-Modified, for If-Range.
+	Encoding  string `json:"encoding,omitempty"`
+}
+
+// partDownload is a download in progress, written to name as it arrives. Its
+// methods do nothing on a nil partDownload, and failing to write the file
+// only loses the ability to resume.
+type partDownload struct {
+	f    *Fetcher
+	name string
+	url  string
+	data []byte   // What an earlier run left, to resume from.
+	meta partMeta // Of data.
+	file *os.File
+}
+
+// loadPart returns the partial download of url kept in the file name, with
+// what an earlier run left there, if it can be resumed.
+func (f *Fetcher) loadPart(name, url string) *partDownload {
+	p := &partDownload{f: f, name: name, url: url}
+	meta, err := os.ReadFile(name + ".json")
+	if err != nil {
+		return p
+	}
+	if err := json.Unmarshal(meta, &p.meta); err != nil || p.meta.URL != url || p.meta.Validator == "" {
+		return p
+	}
+	if p.data, err = os.ReadFile(name); err != nil {
+		p.data = nil
+	}
+	return p
+}
+
+// resumable reports whether the download can start from what an earlier run
+// left.
+func (p *partDownload) resumable() bool {
+	return p != nil && len(p.data) > 0
+}
+
+// start begins writing the download to the file, with prefix, what has been
+// read before res of the same file.
+func (p *partDownload) start(res *http.Response, prefix []byte) {
+	if p == nil {
+		return
+	}
+	p.close()
+	validator := rangeValidator(res.Header)
+	if validator == "" || res.Header.Get("Accept-Ranges") != "bytes" && res.StatusCode != http.StatusPartialContent {
+		// A later run could not ask for just the rest.
+		p.remove()
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p.name), 0755); err != nil {
+		p.fail(err)
+		return
+	}
+	meta, err := json.Marshal(partMeta{URL: p.url, Validator: validator, Encoding: res.Header.Get("Content-Encoding")})
+	if err == nil {
+		err = writeAtomic(p.name+".json", meta, 0644)
+	}
+	if err == nil {
+		p.file, err = os.Create(p.name)
+	}
+	if err == nil {
+		_, err = p.file.Write(prefix)
+	}
+	if err != nil {
+		p.fail(err)
+	}
+}
+
+// tee returns body, copying what is read from it to the file.
+func (p *partDownload) tee(body io.Reader) io.Reader {
+	if p == nil || p.file == nil {
+		return body
+	}
+	return io.TeeReader(body, p)
+}
+
+func (p *partDownload) Write(b []byte) (int, error) {
+	if p.file != nil {
+		if _, err := p.file.Write(b); err != nil {
+			p.fail(err)
+		}
+	}
+	return len(b), nil
+}
+
+func (p *partDownload) fail(err error) {
+	p.f.logger().Warn("failed to keep partial download", "url", p.url, "file", p.name, "err", err)
+	p.remove()
+}
+
+func (p *partDownload) close() {
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+}
+
+// remove deletes the file, once the download is complete or can't be resumed.
+func (p *partDownload) remove() {
+	if p == nil {
+		return
+	}
+	p.close()
+	os.Remove(p.name)
+	os.Remove(p.name + ".json")
+}
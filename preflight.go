@@ -0,0 +1,64 @@
+package oam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var errTooLarge = errors.New("file too large")
+
+// preflight sends a HEAD request with the method, URL and headers of req,
+// failing when the file doesn't exist or is larger than MaxSize. Any other
+// response, such as from a server that doesn't support HEAD, leaves it to
+// the GET to tell.
+func (f *Fetcher) preflight(client *http.Client, req *http.Request) error {
+	head := req.Clone(req.Context())
+	head.Method = http.MethodHead
+	head.Header.Del("If-None-Match")
+	head.Header.Del("If-Modified-Since")
+	head.Header.Del("Range")
+	head.Header.Del("If-Range")
+
+	res, err := f.doWithRetry(client, head)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return &statusError{URL: req.URL.String(), StatusCode: res.StatusCode, Status: res.Status}
+	case res.StatusCode != http.StatusOK:
+		f.logger().Debug("HEAD not answered, falling back to GET", "url", req.URL.String(), "status", res.StatusCode)
+		return nil
+	}
+	return f.checkSize(req, res.ContentLength)
+}
+
+// checkSize fails a file of n bytes, or -1 if unknown, that is larger than
+// MaxSize.
+func (f *Fetcher) checkSize(req *http.Request, n int64) error {
+	if f.MaxSize > 0 && n > f.MaxSize {
+		return fmt.Errorf("%w: %s is %d bytes, more than the maximum of %d", errTooLarge, req.URL, n, f.MaxSize)
+	}
+	return nil
+}
+
+// copyBody appends body to buf, failing once buf would hold more than MaxSize
+// bytes.
+func (f *Fetcher) copyBody(req *http.Request, buf *bytes.Buffer, body io.Reader) error {
+	if f.MaxSize <= 0 {
+		_, err := io.Copy(buf, body)
+		return err
+	}
+	// Read one byte past the limit to tell a full file from one too large.
+	if _, err := io.Copy(buf, io.LimitReader(body, f.MaxSize-int64(buf.Len())+1)); err != nil {
+		return err
+	}
+	if int64(buf.Len()) > f.MaxSize {
+		return fmt.Errorf("%w: %s is more than the maximum of %d bytes", errTooLarge, req.URL, f.MaxSize)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package oam
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	providerGitHub    = "github"
+	providerGitLab    = "gitlab"
+	providerBitbucket = "bitbucket"
+)
+
+// provider returns the repo's hosting provider, defaulting to GitHub.
+func (r Repo) provider() string {
+	if r.Provider == "" {
+		return providerGitHub
+	}
+	return r.Provider
+}
+
+// rawURL builds the URL of the raw file at path for the repo's provider. Each
+// segment of the repo, version and path is escaped on its own, keeping nested
+// GitLab groups and branches with slashes intact.
+func (r Repo) rawURL(path string) (string, error) {
+	base := r.BaseURL
+	switch r.provider() {
+	case providerGitHub:
+		if base == "" {
+			base = "https://raw.githubusercontent.com"
+		}
+		return fmt.Sprintf("%s/%s/%s/%s", base, escapePath(r.URL), escapePath(r.Version), escapePath(path)), nil
+	case providerGitLab:
+		if base == "" {
+			base = "https://gitlab.com"
+		}
+		return fmt.Sprintf("%s/%s/-/raw/%s/%s", base, escapePath(r.URL), escapePath(r.Version), escapePath(path)), nil
+	case providerBitbucket:
+		if base == "" {
+			base = "https://bitbucket.org"
+		}
+		return fmt.Sprintf("%s/%s/raw/%s/%s", base, escapePath(r.URL), escapePath(r.Version), escapePath(path)), nil
+	default:
+		return "", fmt.Errorf("unknown provider %q", r.Provider)
+	}
+}
+
+// escapePath escapes each segment of a slash-separated path.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
@@ -0,0 +1,46 @@
+package oam
+
+import "testing"
+
+func TestRawURL(t *testing.T) {
+	tests := []struct {
+		name string
+		repo Repo
+		path string
+		want string
+	}{
+		{"github", Repo{URL: "acme/api", Version: "v1.2.0"}, "spec/openapi.yaml",
+			"https://raw.githubusercontent.com/acme/api/v1.2.0/spec/openapi.yaml"},
+		{"github base_url", Repo{URL: "acme/api", Version: "main", BaseURL: "https://ghe.example.com/raw"}, "openapi.yaml",
+			"https://ghe.example.com/raw/acme/api/main/openapi.yaml"},
+		{"gitlab", Repo{URL: "acme/api", Version: "v1.2.0", Provider: providerGitLab}, "spec/openapi.yaml",
+			"https://gitlab.com/acme/api/-/raw/v1.2.0/spec/openapi.yaml"},
+		{"gitlab nested groups", Repo{URL: "acme/platform/billing/api", Version: "main", Provider: providerGitLab}, "openapi.yaml",
+			"https://gitlab.com/acme/platform/billing/api/-/raw/main/openapi.yaml"},
+		{"gitlab escaping", Repo{URL: "acme/my group/api#1", Version: "release/1.0", Provider: providerGitLab}, "docs/open api.yaml",
+			"https://gitlab.com/acme/my%20group/api%231/-/raw/release/1.0/docs/open%20api.yaml"},
+		{"gitlab base_url", Repo{URL: "acme/api", Version: "main", Provider: providerGitLab, BaseURL: "https://gitlab.example.com"}, "openapi.yaml",
+			"https://gitlab.example.com/acme/api/-/raw/main/openapi.yaml"},
+		{"bitbucket", Repo{URL: "acme/api", Version: "v1.2.0", Provider: providerBitbucket}, "spec/openapi.yaml",
+			"https://bitbucket.org/acme/api/raw/v1.2.0/spec/openapi.yaml"},
+		{"github escaping", Repo{URL: "acme/api", Version: "release/1.0", BaseURL: "https://raw.example.com"}, "docs/open api#v1.yaml",
+			"https://raw.example.com/acme/api/release/1.0/docs/open%20api%23v1.yaml"},
+		{"bitbucket escaping", Repo{URL: "acme/my api", Version: "v1?", Provider: providerBitbucket}, "docs/open api.yaml",
+			"https://bitbucket.org/acme/my%20api/raw/v1%3F/docs/open%20api.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.repo.rawURL(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rawURL(%q) = %s, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (Repo{URL: "acme/api", Version: "main", Provider: "sourcehut"}).rawURL("openapi.yaml"); err == nil {
+		t.Error("rawURL succeeded for an unknown provider")
+	}
+}
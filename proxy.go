@@ -0,0 +1,38 @@
+package oam
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFunc returns the proxy selection for the fetcher's transport. Without
+// an explicit Proxy it behaves like http.ProxyFromEnvironment; with one, that
+// proxy is used for all requests except hosts matched by NO_PROXY.
+func (f *Fetcher) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if f.Proxy == nil {
+		return http.ProxyFromEnvironment
+	}
+
+	config := httpproxy.Config{
+		HTTPProxy:  f.Proxy.String(),
+		HTTPSProxy: f.Proxy.String(),
+		NoProxy:    getenvAny("NO_PROXY", "no_proxy"),
+	}
+	proxy := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// getenvAny returns the value of the first of the environment variables that is set.
+func getenvAny(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
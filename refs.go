@@ -0,0 +1,255 @@
+package oam
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultRefDepth = 10
+
+func (f *Fetcher) refDepth() int {
+	if f.RefDepth > 0 {
+		return f.RefDepth
+	}
+	return defaultRefDepth
+}
+
+// fetchRefs downloads the files referenced by a spec, written to specFile,
+// from the same repo and version, and writes them where refFile says, with
+// their own $refs rewritten to match.
+func (r *run) fetchRefs(t target, specFile string, data []byte) error {
+	visited := map[string]bool{t.Path: true}
+	return r.fetchRefsFrom(t, specFile, t.Path, data, 1, visited)
+}
+
+// refRoot returns the directory referenced files must be written under: the
+// repo's directory, or the output directory with an output template or a
+// repo's own output file.
+func (r *run) refRoot(t target) string {
+	if r.f.OutputTemplate != nil || t.Repo.Output != "" {
+		return ""
+	}
+	return t.Name + "/"
+}
+
+func (r *run) fetchRefsFrom(t target, specFile, from string, data []byte, depth int, visited map[string]bool) error {
+	refs, err := fileRefs(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", from, err)
+	}
+
+	for _, ref := range refs {
+		p := path.Join(path.Dir(from), ref)
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return fmt.Errorf("$ref %s in %s points outside the repo", ref, from)
+		}
+		if visited[p] {
+			continue
+		}
+		visited[p] = true
+		if depth > r.f.refDepth() {
+			return fmt.Errorf("$ref depth limit of %d exceeded at %s", r.f.refDepth(), p)
+		}
+
+		file, err := r.f.download(r.ctx, t.Name, t.Repo, p, false)
+		if err != nil {
+			return err
+		}
+		body := file.Data
+		if isSpecFile(p) {
+			if body, err = r.strip(t, p, body); err != nil {
+				return err
+			}
+		}
+
+		out, err := r.refFile(t, specFile, p)
+		if err != nil {
+			return err
+		}
+		written := body
+		if isSpecFile(p) {
+			if written, err = r.rewriteRefs(t, specFile, p, body); err != nil {
+				return err
+			}
+		}
+		if err := r.saveFile(file, t.Name, p, filepath.FromSlash(out), written); err != nil {
+			return err
+		}
+
+		if isSpecFile(p) {
+			if err := r.fetchRefsFrom(t, specFile, p, body, depth+1, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// refFile returns where the file at p, referenced from the spec written to
+// specFile, is written: slash-separated and relative to the output directory.
+// That is at the same location relative to the spec as in the repo, unless
+// that is outside the repo's output directory, as it is for a file higher up
+// than the spec when the spec is not written at its path in the repo. Such a
+// file is written at its path in the repo under the spec's directory instead.
+func (r *run) refFile(t target, specFile, p string) (string, error) {
+	specFile = filepath.ToSlash(specFile)
+	if p == t.Path {
+		return specFile, nil
+	}
+	rel, err := relPath(path.Dir(t.Path), p)
+	if err != nil {
+		return "", err
+	}
+	inside := func(out string) bool {
+		return out != ".." && !strings.HasPrefix(out, "../") && strings.HasPrefix(out, r.refRoot(t))
+	}
+	out := path.Join(path.Dir(specFile), rel)
+	if !inside(out) {
+		out = path.Join(path.Dir(specFile), p)
+	}
+	if !inside(out) {
+		return "", fmt.Errorf("cannot write %s outside the repo's output directory", p)
+	}
+	return out, nil
+}
+
+// rewriteRefs points the relative $refs of the file at from, which is t's spec
+// or a file it references, at where the files they reference are written,
+// keeping any #fragment. The file is re-encoded only if a $ref changed.
+func (r *run) rewriteRefs(t target, specFile, from string, data []byte) ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", from, err)
+	}
+	self, err := r.refFile(t, specFile, from)
+	if err != nil {
+		return nil, err
+	}
+
+	var rewriteErr error
+	changed := mapRefs(doc, func(ref string) string {
+		file, fragment := ref, ""
+		if i := strings.IndexByte(ref, '#'); i >= 0 {
+			file, fragment = ref[:i], ref[i:]
+		}
+		if file == "" || strings.Contains(file, "://") || path.IsAbs(file) {
+			return ref
+		}
+		p := path.Join(path.Dir(from), file)
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return ref // Reported when fetching it.
+		}
+		out, err := r.refFile(t, specFile, p)
+		if err == nil {
+			out, err = relPath(path.Dir(self), out)
+		}
+		if err != nil {
+			rewriteErr = err
+			return ref
+		}
+		if out == path.Clean(file) {
+			return ref
+		}
+		return out + fragment
+	})
+	if rewriteErr != nil {
+		return nil, rewriteErr
+	}
+	if changed == 0 {
+		return data, nil
+	}
+	r.logger().Debug("rewrote $refs", "repo", t.Name, "path", from, "refs", changed)
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	if detectFormat(data) == formatJSON {
+		return convert(out, formatJSON)
+	}
+	return out, nil
+}
+
+// mapRefs replaces the value of every $ref key in a document decoded into
+// yaml.MapSlice with fn's result, returning how many changed.
+func mapRefs(v interface{}, fn func(string) string) int {
+	changed := 0
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for i, item := range v {
+			if s, ok := item.Value.(string); ok && item.Key == "$ref" {
+				if ref := fn(s); ref != s {
+					v[i].Value = ref
+					changed++
+				}
+				continue
+			}
+			changed += mapRefs(item.Value, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			changed += mapRefs(item, fn)
+		}
+	}
+	return changed
+}
+
+// fileRefs returns the file part of every relative $ref in data, sorted and
+// without duplicates. Internal (#/...) and absolute URL refs are skipped.
+func fileRefs(data []byte) ([]string, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	walkRefs(doc, func(ref string) {
+		if i := strings.IndexByte(ref, '#'); i >= 0 {
+			ref = ref[:i]
+		}
+		if ref != "" && !strings.Contains(ref, "://") && !path.IsAbs(ref) {
+			seen[ref] = true
+		}
+	})
+
+	refs := make([]string, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// walkRefs calls fn with the value of every $ref key in a decoded YAML document.
+func walkRefs(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		for k, val := range v {
+			if k == "$ref" {
+				if s, ok := val.(string); ok {
+					fn(s)
+					continue
+				}
+			}
+			walkRefs(val, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkRefs(item, fn)
+		}
+	}
+}
+
+// relPath returns target relative to the directory base, both slash-separated.
+func relPath(base, target string) (string, error) {
+	rel, err := filepath.Rel(filepath.FromSlash(base), filepath.FromSlash(target))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,43 @@
+package oam
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFollowsRefsWithDefaultDepth(t *testing.T) {
+	const spec = testSpec + "components:\n  schemas:\n    Pet:\n      $ref: pet.yaml\n"
+	const pet = "type: object\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/pet.yaml") {
+			io.WriteString(w, pet)
+			return
+		}
+		io.WriteString(w, spec)
+	}))
+	defer srv.Close()
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"pets": {URL: "o/r", Version: "main", Path: Paths{"openapi.yaml"}},
+	})
+	// RefDepth is left zero, which must not refuse every $ref.
+	f := testFetcher()
+	f.FollowRefs = true
+	result, err := f.Run(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(result.OutputDir, "pets", "pet.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != pet {
+		t.Errorf("pet.yaml = %q, want %q", got, pet)
+	}
+}
@@ -0,0 +1,65 @@
+package oam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// releaseURL returns the GitHub API URL of the release the repo's asset is
+// attached to: the release tagged with the repo's version, or the latest.
+func (r Repo) releaseURL() (string, error) {
+	api, err := r.apiURL()
+	if err != nil {
+		return "", err
+	}
+	tag := r.releaseTag()
+	if tag == versionLatest {
+		return fmt.Sprintf("%s/repos/%s/releases/latest", api, r.URL), nil
+	}
+	return fmt.Sprintf("%s/repos/%s/releases/tags/%s", api, r.URL, url.PathEscape(tag)), nil
+}
+
+// releaseTag returns the version as configured, before it was pinned to a commit.
+func (r Repo) releaseTag() string {
+	if r.ref != "" {
+		return r.ref
+	}
+	return r.Version
+}
+
+// assetURL looks up the API URL of the repo's release asset, which downloads
+// it when requested as application/octet-stream.
+func (f *Fetcher) assetURL(ctx context.Context, r Repo) (string, error) {
+	endpoint, err := r.releaseURL()
+	if err != nil {
+		return "", err
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"assets"`
+	}
+	err = f.getJSON(ctx, r, endpoint, &release)
+	var se *statusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("no release %s", r.releaseTag())
+	}
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(release.Assets))
+	for _, a := range release.Assets {
+		if a.Name == r.Asset {
+			return a.URL, nil
+		}
+		names = append(names, a.Name)
+	}
+	return "", fmt.Errorf("release %s has no asset %s; it has %s", release.TagName, r.Asset, repoList(names))
+}
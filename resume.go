@@ -0,0 +1,112 @@
+package oam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// readFull reads and decodes the body of res, a 200 response to req sent with
+// client, or a 206 resuming what an earlier run left in part. As it arrives
+// the body is kept in part, if the server lets a later run ask for the rest,
+// and part is removed once it has all been read. When the body is cut short,
+// the download is retried up to Retries times. If the server accepts byte
+// ranges and the response has a validator, the retry asks only for the rest
+// with Range and If-Range; otherwise, or when the file has changed since, it
+// starts over.
+func (f *Fetcher) readFull(client *http.Client, req *http.Request, res *http.Response, part *partDownload) ([]byte, error) {
+	var buf bytes.Buffer
+	if res.StatusCode == http.StatusPartialContent {
+		if !part.resumable() || !resumesAt(res, len(part.data)) || res.Header.Get("Content-Encoding") != part.meta.Encoding {
+			// Not the rest of what part holds after all.
+			res.Body.Close()
+			part.remove()
+			fresh := req.Clone(req.Context())
+			fresh.Header.Del("Range")
+			fresh.Header.Del("If-Range")
+			var err error
+			if res, err = f.doWithRetry(client, fresh); err != nil {
+				return nil, err
+			}
+			if res.StatusCode != http.StatusOK {
+				res.Body.Close()
+				return nil, &statusError{URL: req.URL.String(), StatusCode: res.StatusCode, Status: res.Status}
+			}
+		} else {
+			f.logger().Info("resuming download", "url", req.URL.String(), "offset", len(part.data), "file", part.name)
+			buf.Write(part.data)
+		}
+	}
+	part.start(res, buf.Bytes())
+	err := f.copyBody(req, &buf, part.tee(res.Body))
+	res.Body.Close() // Give up the host slot before any retry takes one.
+	header := res.Header
+
+	for attempt := 1; err != nil && !errors.Is(err, errTooLarge) && attempt <= f.Retries && req.Context().Err() == nil; attempt++ {
+		retry := req.Clone(req.Context())
+		for _, h := range []string{"If-None-Match", "If-Modified-Since", "Range", "If-Range"} {
+			retry.Header.Del(h)
+		}
+		validator := rangeValidator(header)
+		if header.Get("Accept-Ranges") == "bytes" && validator != "" && buf.Len() > 0 {
+			retry.Header.Set("Range", fmt.Sprintf("bytes=%d-", buf.Len()))
+			retry.Header.Set("If-Range", validator)
+			f.logger().Warn("download interrupted, resuming", "url", req.URL.String(), "offset", buf.Len(), "attempt", attempt, "retries", f.Retries, "err", err)
+		} else {
+			f.logger().Warn("download interrupted, restarting", "url", req.URL.String(), "attempt", attempt, "retries", f.Retries, "err", err)
+		}
+
+		res, rerr := f.doWithRetry(client, retry)
+		if rerr != nil {
+			part.close()
+			return nil, rerr
+		}
+		switch {
+		case res.StatusCode == http.StatusOK:
+			buf.Reset()
+			header = res.Header
+			part.start(res, nil)
+		case res.StatusCode == http.StatusPartialContent && resumesAt(res, buf.Len()) &&
+			res.Header.Get("Content-Encoding") == header.Get("Content-Encoding"):
+		default:
+			res.Body.Close()
+			part.close()
+			return nil, fmt.Errorf("failed to resume %s: %s", req.URL, res.Status)
+		}
+		err = f.copyBody(req, &buf, part.tee(res.Body))
+		res.Body.Close()
+	}
+	if errors.Is(err, errTooLarge) {
+		part.remove()
+		return nil, err
+	}
+	if err != nil {
+		part.close() // Kept for a later run to resume.
+		return nil, fmt.Errorf("failed to read %s: %w", req.URL, err)
+	}
+	part.remove()
+	return decodeBody(&buf, header.Get("Content-Encoding"))
+}
+
+// rangeValidator returns the If-Range value for a response: its ETag, unless
+// weak, or its Last-Modified date.
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// resumesAt reports whether a 206 response starts at offset.
+func resumesAt(res *http.Response, offset int) bool {
+	spec, ok := strings.CutPrefix(res.Header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return false
+	}
+	start, _, _ := strings.Cut(spec, "-")
+	n, err := strconv.Atoi(start)
+	return err == nil && n == offset
+}
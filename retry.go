@@ -0,0 +1,178 @@
+package oam
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// doWithRetry sends req with client, retrying on network errors and the
+// statuses of RetryOn.
+// Rate-limited responses pause every request of the fetcher until the limit
+// resets, unless that is past the request's deadline. Each attempt holds one
+// of the MaxPerHost slots of the request's host until its body is closed.
+func (f *Fetcher) doWithRetry(client *http.Client, req *http.Request) (*http.Response, error) {
+	// The client copies it to redirects. A repo's headers may have set it.
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", f.userAgent())
+	}
+	for attempt := 1; ; attempt++ {
+		if err := f.waitRateLimit(req.Context()); err != nil {
+			return nil, err
+		}
+
+		res, err := f.doHost(client, req)
+		wait, limited := rateLimited(res)
+		if l := concurrencyLimitFrom(req.Context()); l != nil {
+			if limited {
+				l.rateLimited()
+			} else if err == nil {
+				l.succeeded()
+			}
+		}
+		if limited {
+			res.Body.Close()
+			until := time.Now().Add(wait)
+			f.pauseUntil(until)
+			deadline, hasDeadline := req.Context().Deadline()
+			if attempt > f.Retries || (hasDeadline && until.After(deadline)) {
+				return nil, fmt.Errorf("rate limited by %s until %s", req.URL.Host, until.Format(time.RFC3339))
+			}
+			f.logger().Warn("rate limited, waiting", "url", req.URL.String(), "delay", wait.Round(time.Second), "attempt", attempt, "retries", f.Retries)
+			continue
+		}
+		if attempt > f.Retries || req.Context().Err() != nil || !f.shouldRetry(res, err) {
+			return res, err
+		}
+
+		delay := backoff(f.RetryDelay, attempt, res)
+		status := 0
+		if res != nil {
+			status = res.StatusCode
+			res.Body.Close()
+		}
+		f.logger().Warn("retrying request", "url", req.URL.String(), "delay", delay, "status", status, "attempt", attempt, "retries", f.Retries)
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rateLimited reports whether res is a rate-limit response and how long to
+// wait before retrying. A 403 without rate-limit headers is a permission
+// error and is not retried.
+func rateLimited(res *http.Response) (time.Duration, bool) {
+	if res == nil || (res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests) {
+		return 0, false
+	}
+	if d, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+		return d, true
+	}
+	if res.Header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	// Wait a second past the reset to allow for clock skew.
+	if d := time.Until(time.Unix(reset, 0)) + time.Second; d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// pauseUntil holds back new requests until t.
+func (f *Fetcher) pauseUntil(t time.Time) {
+	f.rateMu.Lock()
+	defer f.rateMu.Unlock()
+	if t.After(f.rateUntil) {
+		f.rateUntil = t
+	}
+}
+
+// waitRateLimit waits until a rate limit seen by any request has reset.
+func (f *Fetcher) waitRateLimit(ctx context.Context) error {
+	f.rateMu.Lock()
+	d := time.Until(f.rateUntil)
+	f.rateMu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	return sleep(ctx, d)
+}
+
+func (f *Fetcher) userAgent() string {
+	if f.UserAgent != "" {
+		return f.UserAgent
+	}
+	return "oam"
+}
+
+// shouldRetry reports whether a request failed in a way worth retrying: a
+// network error, or a status in RetryOn, by default 429 or 5xx. A 404 is
+// never retried, as the file won't appear by asking again, and neither is a
+// HEAD request the server doesn't support.
+func (f *Fetcher) shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return false
+	}
+	if res.Request.Method == http.MethodHead && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+		return false
+	}
+	if f.RetryOn == nil {
+		return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	}
+	return slices.Contains(f.RetryOn, res.StatusCode)
+}
+
+// backoff returns the delay before the given attempt, honoring Retry-After when present.
+func backoff(base time.Duration, attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if d, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+
+	d := base << (attempt - 1)
+	if d <= 0 {
+		return 0
+	}
+	// Add jitter so concurrent retries spread out.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,46 @@
+package oam
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestShouldRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		retryOn []int
+		method  string
+		status  int
+		want    bool
+	}{
+		{"404 by default", nil, "GET", 404, false},
+		{"404 even when listed", []int{404, 500}, "GET", 404, false},
+		{"429 by default", nil, "GET", 429, true},
+		{"500 by default", nil, "GET", 500, true},
+		{"503 by default", nil, "GET", 503, true},
+		{"520 by default", nil, "GET", 520, true},
+		{"403 by default", nil, "GET", 403, false},
+		{"200 by default", nil, "GET", 200, false},
+		{"custom 520", []int{429, 520}, "GET", 520, true},
+		{"custom list without 500", []int{429, 520}, "GET", 500, false},
+		{"empty list", []int{}, "GET", 503, false},
+		{"HEAD not allowed", nil, "HEAD", 405, false},
+		{"HEAD not implemented", nil, "HEAD", 501, false},
+		{"GET not implemented", nil, "GET", 501, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fetcher{RetryOn: tt.retryOn}
+			res := &http.Response{StatusCode: tt.status, Request: &http.Request{Method: tt.method}}
+			if got := f.shouldRetry(res, nil); got != tt.want {
+				t.Errorf("shouldRetry(%d) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldRetryNetworkError(t *testing.T) {
+	if !(&Fetcher{}).shouldRetry(nil, http.ErrHandlerTimeout) {
+		t.Error("network errors are not retried")
+	}
+}
@@ -0,0 +1,118 @@
+package oam
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/openapi-3.0.json schemas/openapi-3.1.json
+var schemaFiles embed.FS
+
+var (
+	schemaOnce sync.Once
+	schemas    map[string]*jsonschema.Schema // Compiled schemas by OpenAPI minor version.
+	schemaErr  error
+)
+
+// compileSchemas compiles the embedded OpenAPI schemas once.
+func compileSchemas() (map[string]*jsonschema.Schema, error) {
+	schemaOnce.Do(func() {
+		schemas = map[string]*jsonschema.Schema{}
+		for _, v := range []string{"3.0", "3.1"} {
+			name := "schemas/openapi-" + v + ".json"
+			data, err := schemaFiles.ReadFile(name)
+			if err != nil {
+				schemaErr = err
+				return
+			}
+			c := jsonschema.NewCompiler()
+			if err := c.AddResource(name, bytes.NewReader(data)); err != nil {
+				schemaErr = err
+				return
+			}
+			if schemas[v], err = c.Compile(name); err != nil {
+				schemaErr = fmt.Errorf("failed to compile %s: %w", name, err)
+				return
+			}
+		}
+	})
+	return schemas, schemaErr
+}
+
+// schemaError lists the ways a spec doesn't match the OpenAPI JSON Schema.
+type schemaError struct {
+	Version  string   // OpenAPI version the spec was checked against, e.g. 3.1.
+	Problems []string // Each prefixed with the JSON pointer of the offending value.
+}
+
+func (e *schemaError) Error() string {
+	return fmt.Sprintf("does not match the OpenAPI %s schema: %s", e.Version, strings.Join(e.Problems, "; "))
+}
+
+// errNoSchema is returned by validateSchema for specs of versions without an
+// embedded schema, such as Swagger 2.0.
+var errNoSchema = errors.New("no schema for this spec version; only OpenAPI 3.0 and 3.1 can be validated")
+
+// validateSchema checks data against the JSON Schema of its declared OpenAPI
+// version.
+func validateSchema(data []byte) error {
+	declared, _ := specVersion(data)
+	v, ok := strings.CutPrefix(declared, "OpenAPI ")
+	if !ok {
+		return errNoSchema
+	}
+	minor := v
+	if parts := strings.SplitN(v, ".", 3); len(parts) >= 2 {
+		minor = parts[0] + "." + parts[1]
+	}
+
+	compiled, err := compileSchemas()
+	if err != nil {
+		return err
+	}
+	schema, ok := compiled[minor]
+	if !ok {
+		return errNoSchema
+	}
+
+	// Go through JSON so numbers and map keys have the types the validator expects.
+	js, err := yamlToJSON(data)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	err = schema.Validate(doc)
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	se := &schemaError{Version: minor}
+	for _, e := range ve.BasicOutput().Errors {
+		// Skip the summaries of nested errors, which are listed separately.
+		if e.Error == "" || strings.HasPrefix(e.Error, "doesn't validate with") {
+			continue
+		}
+		loc := e.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		se.Problems = append(se.Problems, loc+": "+e.Error)
+	}
+	if len(se.Problems) == 0 {
+		se.Problems = []string{ve.Error()}
+	}
+	return se
+}
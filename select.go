@@ -0,0 +1,80 @@
+package oam
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+// SkippedRepo is a repo of the config that a run left out.
+type SkippedRepo struct {
+	Repo   string `json:"repo"`   // Repo name, the key in the config.
+	Reason string `json:"reason"` // Why it was left out, e.g. "disabled".
+}
+
+// enabled reports whether the repo is fetched, which it is unless it sets
+// enabled to false.
+func (r Repo) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// selectRepos returns config with only the repos that are enabled, match one
+// of Only, if set, and match none of Skip, and the repos left out, sorted by
+// name.
+func (f *Fetcher) selectRepos(config Config) (Config, []SkippedRepo, error) {
+	for _, p := range append(append([]string{}, f.Only...), f.Skip...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return config, nil, fmt.Errorf("invalid repo pattern %q", p)
+		}
+	}
+
+	names := make([]string, 0, len(config.Repos))
+	for name := range config.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	repos := make(map[string]Repo, len(config.Repos))
+	var skipped []SkippedRepo
+	used := map[string]bool{}
+	for _, name := range names {
+		if reason := f.skipReason(name, config.Repos[name], used); reason != "" {
+			skipped = append(skipped, SkippedRepo{Repo: name, Reason: reason})
+			continue
+		}
+		repos[name] = config.Repos[name]
+	}
+	for _, p := range f.Only {
+		if !used[p] {
+			f.logger().Warn("pattern matches no repo", "only", p)
+		}
+	}
+
+	config.Repos = repos
+	return config, skipped, nil
+}
+
+// skipReason returns why the repo is left out, or "" if it is fetched. The
+// Only patterns that match it are added to used.
+func (f *Fetcher) skipReason(name string, r Repo, used map[string]bool) string {
+	if len(f.Only) > 0 {
+		matched := false
+		for _, p := range f.Only {
+			if ok, _ := path.Match(p, name); ok {
+				matched, used[p] = true, true
+			}
+		}
+		if !matched {
+			return "matches no Only pattern"
+		}
+	}
+	for _, p := range f.Skip {
+		if ok, _ := path.Match(p, name); ok {
+			return fmt.Sprintf("matches Skip pattern %q", p)
+		}
+	}
+	if !r.enabled() {
+		return "disabled"
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package oam
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version. Build metadata is ignored.
+type semver struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// parseSemver parses versions like 1.2.3, v1.2.3 and 1.2.3-rc.1. When partial
+// is set, missing minor and patch numbers default to zero.
+func parseSemver(s string, partial bool) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, v.Pre = s[:i], s[i+1:]
+		if v.Pre == "" {
+			return v, false
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || (!partial && len(parts) != 3) {
+		return v, false
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		*nums[i] = n
+	}
+	return v, true
+}
+
+// compare returns -1, 0 or 1. A prerelease sorts before its release.
+func (v semver) compare(o semver) int {
+	for _, d := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil && bErr != nil:
+			return -1
+		case aErr != nil && bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+type comparator struct {
+	op string
+	v  semver
+}
+
+// constraint is a list of alternatives separated by ||, each of which is a
+// list of comparators separated by spaces or commas that must all hold.
+type constraint [][]comparator
+
+// isConstraint reports whether a version is a semver constraint rather than a ref.
+func isConstraint(s string) bool {
+	return s != "" && (strings.ContainsAny(s[:1], "<>=!~^") || strings.Contains(s, "||"))
+}
+
+func parseConstraint(s string) (constraint, error) {
+	var c constraint
+	for _, alt := range strings.Split(s, "||") {
+		var all []comparator
+		for _, f := range strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' }) {
+			i := 0
+			for i < len(f) && strings.IndexByte("<>=!~^", f[i]) >= 0 {
+				i++
+			}
+			op := f[:i]
+			v, ok := parseSemver(f[i:], true)
+			if !ok {
+				return nil, fmt.Errorf("invalid version constraint %q", f)
+			}
+			switch op {
+			case "", "=", "==", "!=", ">", ">=", "<", "<=", "~", "^":
+			default:
+				return nil, fmt.Errorf("invalid operator in %q", f)
+			}
+			all = append(all, comparator{op, v})
+		}
+		if len(all) == 0 {
+			return nil, fmt.Errorf("empty version constraint %q", s)
+		}
+		c = append(c, all)
+	}
+	return c, nil
+}
+
+func (c constraint) matches(v semver) bool {
+	for _, all := range c {
+		ok := true
+		for _, cmp := range all {
+			if !cmp.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparator) matches(v semver) bool {
+	d := v.compare(c.v)
+	switch c.op {
+	case "", "=", "==":
+		return d == 0
+	case "!=":
+		return d != 0
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	case "~":
+		// Same major and minor version.
+		return d >= 0 && v.Major == c.v.Major && v.Minor == c.v.Minor
+	case "^":
+		// Same major version, or same minor version for 0.x.
+		if c.v.Major == 0 {
+			return d >= 0 && v.Major == 0 && v.Minor == c.v.Minor
+		}
+		return d >= 0 && v.Major == c.v.Major
+	}
+	return false
+}
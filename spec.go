@@ -0,0 +1,62 @@
+package oam
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// validateSpec checks that data is YAML or JSON with an openapi or swagger root key.
+func validateSpec(data []byte) error {
+	var root map[string]interface{}
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("not valid YAML or JSON: %w", err)
+	}
+	if _, ok := root["openapi"]; ok {
+		return nil
+	}
+	if _, ok := root["swagger"]; ok {
+		return nil
+	}
+	return errors.New("missing openapi or swagger root key")
+}
+
+// specVersion returns the declared version of a spec, such as "OpenAPI 3.1.0"
+// or "Swagger 2.0", or false if it declares none. Only the root keys are
+// looked at.
+func specVersion(data []byte) (string, bool) {
+	var root struct {
+		OpenAPI interface{} `yaml:"openapi"`
+		Swagger interface{} `yaml:"swagger"`
+	}
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return "", false
+	}
+	if v, ok := versionString(root.OpenAPI); ok {
+		return "OpenAPI " + v, true
+	}
+	if v, ok := versionString(root.Swagger); ok {
+		return "Swagger " + v, true
+	}
+	return "", false
+}
+
+// versionString formats a version scalar. Unquoted versions such as 2.0 are
+// decoded as numbers.
+func versionString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, v != ""
+	case int:
+		return strconv.Itoa(v) + ".0", true
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if v == float64(int64(v)) {
+			s += ".0"
+		}
+		return s, true
+	}
+	return "", false
+}
@@ -0,0 +1,90 @@
+package oam
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Kinds of RepoChange.
+const (
+	RepoNew     = "new"     // The config has the repo, but the lock doesn't.
+	RepoChanged = "changed" // The repo's url, version, path or asset differ from the lock's.
+	RepoRemoved = "removed" // The lock has the repo, but the config doesn't.
+)
+
+// RepoChange is a difference between a repo in the config and the lock.
+type RepoChange struct {
+	Repo   string // Repo name, the key in the config or lock.
+	Kind   string // RepoNew, RepoChanged or RepoRemoved.
+	Detail string // For changed repos, what changed, e.g. version v1 -> v2.
+}
+
+func (c RepoChange) String() string {
+	switch c.Kind {
+	case RepoNew:
+		return c.Repo + ": not fetched yet"
+	case RepoRemoved:
+		return c.Repo + ": in the lock but not the config"
+	default:
+		return c.Repo + ": changed, " + c.Detail
+	}
+}
+
+// TreeStatus is how the config, the lock and the output directory differ.
+type TreeStatus struct {
+	Repos []RepoChange // Sorted by repo name.
+	Files []Drift      // Sorted by file, as Verify returns them.
+}
+
+// Clean reports whether there are no differences.
+func (s *TreeStatus) Clean() bool {
+	return len(s.Repos) == 0 && len(s.Files) == 0
+}
+
+// Status compares the repos of config with the lock, and the files in the
+// config's output directory with those the lock records, without any network
+// access. Disabled repos are left out.
+func Status(config Config, lock Lock) (*TreeStatus, error) {
+	s := &TreeStatus{}
+	for name, r := range config.Repos {
+		if !r.enabled() {
+			continue
+		}
+		old, ok := lock.Repos[name]
+		if !ok {
+			s.Repos = append(s.Repos, RepoChange{Repo: name, Kind: RepoNew})
+			continue
+		}
+		var changes []string
+		if old.URL != r.URL {
+			changes = append(changes, fmt.Sprintf("url %s -> %s", old.URL, r.URL))
+		}
+		if old.Version != r.Version {
+			changes = append(changes, fmt.Sprintf("version %s -> %s", old.Version, r.Version))
+		}
+		if !slices.Equal(old.Path, r.Path) {
+			changes = append(changes, fmt.Sprintf("path %s -> %s", strings.Join(old.Path, ","), strings.Join(r.Path, ",")))
+		}
+		if old.Asset != r.Asset {
+			changes = append(changes, fmt.Sprintf("asset %s -> %s", old.Asset, r.Asset))
+		}
+		if len(changes) > 0 {
+			s.Repos = append(s.Repos, RepoChange{Repo: name, Kind: RepoChanged, Detail: strings.Join(changes, ", ")})
+		}
+	}
+	for name := range lock.Repos {
+		if _, ok := config.Repos[name]; !ok {
+			s.Repos = append(s.Repos, RepoChange{Repo: name, Kind: RepoRemoved})
+		}
+	}
+	sort.Slice(s.Repos, func(i, j int) bool { return s.Repos[i].Repo < s.Repos[j].Repo })
+
+	files, err := Verify(config.OutputDir, lock)
+	if err != nil {
+		return nil, err
+	}
+	s.Files = files
+	return s, nil
+}
@@ -0,0 +1,154 @@
+package oam
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Extensions lists the prefixes of vendor extension keys, such as x-internal-.
+// In config it is either a list of prefixes or a boolean, where true means
+// every extension (x-) and false none.
+type Extensions []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *Extensions) UnmarshalJSON(data []byte) error {
+	var all bool
+	if err := json.Unmarshal(data, &all); err == nil {
+		*e = extensionsFromBool(all)
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*e = list
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (e *Extensions) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var all bool
+	if err := unmarshal(&all); err == nil {
+		*e = extensionsFromBool(all)
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*e = list
+	return nil
+}
+
+// extensionsFromBool returns every extension for true, and an empty but
+// non-nil list for false so that it overrides the fetcher's setting.
+func extensionsFromBool(all bool) Extensions {
+	if all {
+		return Extensions{"x-"}
+	}
+	return Extensions{}
+}
+
+func (e Extensions) problems() []string {
+	var problems []string
+	for _, p := range e {
+		if !strings.HasPrefix(p, "x-") {
+			problems = append(problems, fmt.Sprintf("strip_extensions prefix %q does not start with x-", p))
+		}
+	}
+	return problems
+}
+
+// stripExtensions returns the extension prefixes to remove from the repo's
+// specs, defaulting to the fetcher's.
+func (f *Fetcher) stripExtensions(r Repo) Extensions {
+	if r.StripExtensions != nil {
+		return r.StripExtensions
+	}
+	return f.StripExtensions
+}
+
+// namedMaps are the keys whose values map user-chosen names, such as schema
+// properties or header names, which are kept even when they look like
+// extensions.
+var namedMaps = map[string]bool{
+	"properties":      true,
+	"headers":         true,
+	"schemas":         true,
+	"definitions":     true,
+	"parameters":      true,
+	"examples":        true,
+	"requestBodies":   true,
+	"securitySchemes": true,
+	"links":           true,
+	"callbacks":       true,
+	"pathItems":       true,
+	"webhooks":        true,
+	"encoding":        true,
+	"mapping":         true,
+	"variables":       true,
+	"scopes":          true,
+}
+
+// stripSpec removes the keys matching prefixes from every object in the spec.
+// The spec is returned unchanged when nothing matches, and re-encoded as YAML,
+// keeping the key order, otherwise.
+func stripSpec(data []byte, prefixes Extensions) ([]byte, int, error) {
+	if len(prefixes) == 0 {
+		return data, 0, nil
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	v, n := stripValue(doc, prefixes, false)
+	if n == 0 {
+		return data, 0, nil
+	}
+	out, err := yaml.Marshal(v)
+	return out, n, err
+}
+
+// stripValue removes matching keys from v, returning the new value and the
+// number of keys removed. named is set when v's keys are names, not fields.
+func stripValue(v interface{}, prefixes Extensions, named bool) (interface{}, int) {
+	removed := 0
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		kept := v[:0]
+		for _, item := range v {
+			key := fmt.Sprint(item.Key)
+			if !named && hasAnyPrefix(key, prefixes) {
+				removed++
+				continue
+			}
+			var n int
+			item.Value, n = stripValue(item.Value, prefixes, !named && namedMaps[key])
+			removed += n
+			kept = append(kept, item)
+		}
+		return kept, removed
+	case []interface{}:
+		for i, item := range v {
+			var n int
+			v[i], n = stripValue(item, prefixes, false)
+			removed += n
+		}
+	}
+	return v, removed
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
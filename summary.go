@@ -0,0 +1,56 @@
+package oam
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// summary is the JSON form of a Result written by WriteSummary.
+type summary struct {
+	Succeeded  int           `json:"succeeded"`
+	Failed     int           `json:"failed"`
+	Cached     int           `json:"cached"`
+	Abandoned  int           `json:"abandoned"`
+	Skipped    int           `json:"skipped"`
+	DurationMS int64         `json:"duration_ms"`
+	Repos      []repoSummary `json:"repos"`
+	// Repos left out of the run, with why.
+	SkippedRepos []SkippedRepo `json:"skipped_repos,omitempty"`
+}
+
+type repoSummary struct {
+	Repo      string   `json:"repo"`
+	OK        bool     `json:"ok"`
+	Files     int      `json:"files"`
+	Failed    int      `json:"failed"`
+	Abandoned bool     `json:"abandoned,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// WriteSummary writes the counts of succeeded, failed and cached files and the
+// outcome of each repo to w, as a single line of JSON, followed by the skipped
+// repos. Abandoned files count as failed.
+func (r *Result) WriteSummary(w io.Writer) error {
+	s := summary{Skipped: len(r.Skipped), DurationMS: r.Duration.Milliseconds(), Repos: []repoSummary{}, SkippedRepos: r.Skipped}
+	for _, repo := range r.Repos() {
+		rs := repoSummary{Repo: repo.Repo, Files: len(repo.Files)}
+		for _, f := range repo.Files {
+			switch {
+			case f.Err != nil:
+				rs.Failed++
+				rs.Errors = append(rs.Errors, f.Err.Error())
+				if f.Abandoned {
+					rs.Abandoned = true
+					s.Abandoned++
+				}
+			case f.Cached:
+				s.Cached++
+			}
+		}
+		rs.OK = rs.Failed == 0
+		s.Failed += rs.Failed
+		s.Succeeded += rs.Files - rs.Failed
+		s.Repos = append(s.Repos, rs)
+	}
+	return json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,59 @@
+package oam
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing breaks down the time spent downloading a file, summed over retries.
+// Phases skipped on a reused connection are zero.
+type Timing struct {
+	DNS       time.Duration // Resolving the host name.
+	Connect   time.Duration // Establishing the TCP connection.
+	TLS       time.Duration // The TLS handshake.
+	FirstByte time.Duration // From sending the request to the first byte of the response.
+}
+
+// timingTrace records a Timing from the events of an HTTP client trace.
+type timingTrace struct {
+	mu                                     sync.Mutex
+	timing                                 Timing
+	dnsStart, connectStart, tlsStart, sent time.Time
+}
+
+// withTiming returns a context recording the timing of the requests made
+// with it.
+func withTiming(ctx context.Context) (context.Context, *timingTrace) {
+	t := &timingTrace{}
+	span := func(start *time.Time, total *time.Duration, begin bool) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if begin {
+			*start = time.Now()
+		} else if !start.IsZero() {
+			*total += time.Since(*start)
+			*start = time.Time{}
+		}
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { span(&t.dnsStart, &t.timing.DNS, true) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { span(&t.dnsStart, &t.timing.DNS, false) },
+		ConnectStart:      func(string, string) { span(&t.connectStart, &t.timing.Connect, true) },
+		ConnectDone:       func(string, string, error) { span(&t.connectStart, &t.timing.Connect, false) },
+		TLSHandshakeStart: func() { span(&t.tlsStart, &t.timing.TLS, true) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			span(&t.tlsStart, &t.timing.TLS, false)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { span(&t.sent, &t.timing.FirstByte, true) },
+		GotFirstResponseByte: func() { span(&t.sent, &t.timing.FirstByte, false) },
+	}), t
+}
+
+func (t *timingTrace) get() Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timing
+}
@@ -0,0 +1,65 @@
+package oam
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithTransform(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, testSpec)
+	}))
+	defer srv.Close()
+
+	errRedact := errors.New("cannot redact")
+	f := NewFetcher(
+		WithTransform(func(repo string, data []byte) ([]byte, error) {
+			return append(data, "# first\n"...), nil
+		}),
+		WithTransform(func(repo string, data []byte) ([]byte, error) {
+			if repo == "bad" {
+				return nil, errRedact
+			}
+			return append(data, "# second\n"...), nil
+		}),
+	)
+	f.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	config := testConfig(t, srv.URL, map[string]Repo{
+		"good": {URL: "o/good", Version: "main", Path: Paths{"openapi.yaml"}},
+		"bad":  {URL: "o/bad", Version: "main", Path: Paths{"openapi.yaml"}},
+	})
+	result, err := f.Run(context.Background(), config)
+	if err == nil {
+		t.Fatal("run with a failing transform succeeded")
+	}
+
+	// Transforms compose in the order they were given.
+	if got, want := string(readOutput(t, result, "good")), testSpec+"# first\n# second\n"; got != want {
+		t.Errorf("good = %q, want %q", got, want)
+	}
+
+	// The error fails only its repo.
+	if got := result.FailedRepos(); !slices.Equal(got, []string{"bad"}) {
+		t.Errorf("FailedRepos() = %v, want [bad]", got)
+	}
+	for _, repo := range result.Repos() {
+		if repo.Repo != "bad" {
+			continue
+		}
+		var fe *FetchError
+		if !errors.As(repo.Err, &fe) || !errors.Is(repo.Err, errRedact) {
+			t.Fatalf("bad: error %v is not a *FetchError wrapping the transform's", repo.Err)
+		}
+		if !strings.Contains(fe.Error(), "transform 2") {
+			t.Errorf("bad: error %q doesn't name the transform", fe.Error())
+		}
+	}
+}
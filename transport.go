@@ -0,0 +1,102 @@
+package oam
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 20
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+)
+
+// transport returns the transport of the fetcher's default client. Unlike
+// http.DefaultTransport, which keeps two idle connections per host, it keeps
+// enough for a run's concurrent requests to the same host to reuse them.
+func (f *Fetcher) transport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: f.keepAlive()}
+	return &http.Transport{
+		TLSClientConfig:       &tls.Config{RootCAs: f.RootCAs},
+		Proxy:                 f.proxyFunc(),
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   f.maxIdleConnsPerHost(),
+		IdleConnTimeout:       f.idleConnTimeout(),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// LoadCAFile returns the system's root certificates with those in the PEM
+// file at path added, for Fetcher.RootCAs.
+func LoadCAFile(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in CA file %s", path)
+	}
+	return pool, nil
+}
+
+func (f *Fetcher) maxIdleConnsPerHost() int {
+	if f.MaxIdleConnsPerHost > 0 {
+		return f.MaxIdleConnsPerHost
+	}
+	return defaultMaxIdleConnsPerHost
+}
+
+func (f *Fetcher) idleConnTimeout() time.Duration {
+	if f.IdleConnTimeout > 0 {
+		return f.IdleConnTimeout
+	}
+	return defaultIdleConnTimeout
+}
+
+func (f *Fetcher) keepAlive() time.Duration {
+	if f.KeepAlive != 0 {
+		return f.KeepAlive
+	}
+	return defaultKeepAlive
+}
+
+// warnInsecure logs every repo whose certificates won't be verified, so that
+// is never on unnoticed.
+func (r *run) warnInsecure(config Config, names []string) {
+	if r.f.Insecure {
+		r.logger().Warn("INSECURE: TLS certificate verification is disabled for every request")
+		return
+	}
+	for _, name := range names {
+		if repo := config.Repos[name]; repo.InsecureSkipVerify && repo.LocalPath == "" {
+			r.logger().Warn("INSECURE: TLS certificate verification is disabled", "repo", name)
+		}
+	}
+}
+
+// clientFor returns the client for requests of r: the default one, or one that
+// skips TLS certificate verification when r or the fetcher is insecure. A
+// Client set on the fetcher is always used as is.
+func (f *Fetcher) clientFor(r Repo) *http.Client {
+	if f.Client != nil || !(f.Insecure || r.InsecureSkipVerify) {
+		return f.client()
+	}
+	f.insecureOnce.Do(func() {
+		transport := f.transport()
+		transport.TLSClientConfig.InsecureSkipVerify = true
+		f.insecureClient = &http.Client{Timeout: f.timeout(), Transport: transport}
+	})
+	return f.insecureClient
+}
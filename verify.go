@@ -0,0 +1,132 @@
+package oam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Kinds of Drift.
+const (
+	DriftMissing  = "missing"  // The lock lists the file, but it isn't on disk.
+	DriftModified = "modified" // The file's checksum differs from the lock's.
+	DriftExtra    = "extra"    // The file is on disk, but the lock doesn't list it.
+)
+
+// Drift is a difference between the output directory and the lock.
+type Drift struct {
+	Repo     string // Repo the lock lists the file under; empty for extra files.
+	File     string // Path of the file, slash-separated and relative to the output directory.
+	Kind     string // DriftMissing, DriftModified or DriftExtra.
+	Expected string // Checksum in the lock; empty for extra files.
+	Actual   string // Checksum of the file on disk; empty for missing files.
+}
+
+func (d Drift) String() string {
+	switch d.Kind {
+	case DriftMissing:
+		return fmt.Sprintf("%s: missing, expected sha256 %s", d.File, d.Expected)
+	case DriftModified:
+		return fmt.Sprintf("%s: modified, expected sha256 %s, got %s", d.File, d.Expected, d.Actual)
+	default:
+		return fmt.Sprintf("%s: not in the lock, sha256 %s", d.File, d.Actual)
+	}
+}
+
+// Verify compares the files under outputDir with those the lock records,
+// returning every difference, sorted by file. It reads but never writes. An
+// empty outputDir is the default, ./oam. Files oam writes besides the specs
+// are not counted as extra: the checksums.txt written by WriteChecksums, those
+// the lock lists as generated, and the partial downloads and temporary files
+// of an interrupted run.
+func Verify(outputDir string, lock Lock) ([]Drift, error) {
+	if outputDir == "" {
+		outputDir = DefaultOutputDir
+	}
+	locked := map[string]Drift{}
+	for name, entry := range lock.Repos {
+		for _, f := range entry.Files {
+			if !filepath.IsLocal(filepath.FromSlash(f.Output)) {
+				return nil, fmt.Errorf("lock lists %s outside the output directory", f.Output)
+			}
+			locked[f.Output] = Drift{Repo: name, File: f.Output, Expected: f.SHA256}
+		}
+	}
+
+	var drift []Drift
+	seen := map[string]bool{}
+	err := filepath.WalkDir(outputDir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == outputDir {
+			return filepath.SkipAll // Every locked file is missing.
+		}
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if lock.generated(rel) {
+			return nil
+		}
+		sum, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+		want, ok := locked[rel]
+		switch {
+		case !ok:
+			drift = append(drift, Drift{File: rel, Kind: DriftExtra, Actual: sum})
+		case sum != want.Expected:
+			want.Kind, want.Actual = DriftModified, sum
+			drift = append(drift, want)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for file, want := range locked {
+		if !seen[file] {
+			want.Kind = DriftMissing
+			drift = append(drift, want)
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].File < drift[j].File })
+	return drift, nil
+}
+
+// generated reports whether the file at rel, relative to the output
+// directory, is one oam writes besides the specs.
+func (l Lock) generated(rel string) bool {
+	base := path.Base(rel)
+	switch {
+	case rel == "checksums.txt", slices.Contains(l.Generated, rel):
+		return true
+	case strings.HasSuffix(base, ".part"), strings.HasSuffix(base, ".part.json"):
+		return true // Kept by partDownload to resume from.
+	case strings.HasPrefix(base, ".") && strings.HasSuffix(base, ".tmp"):
+		return true // Left by writeAtomic.
+	}
+	return false
+}
+
+func fileSHA256(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
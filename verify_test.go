@@ -0,0 +1,51 @@
+package oam
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestVerifyIgnoresGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"pets/openapi.yaml",
+		"checksums.txt",
+		"manifest.json",
+		"merged/openapi.yaml",
+		"pets/users.yaml.part",
+		"pets/users.yaml.part.json",
+		"pets/.openapi.yaml.123.tmp",
+		"notes.txt",
+	} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(testSpec), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum, err := fileSHA256(filepath.Join(dir, "pets", "openapi.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := Lock{Repos: map[string]LockedRepo{
+		"pets": {URL: "o/r", Version: "main", Files: []LockedFile{{Path: "openapi.yaml", Output: "pets/openapi.yaml", SHA256: sum}}},
+	}}
+	lock.AddGenerated(dir, filepath.Join(dir, "manifest.json"))
+	lock.AddGenerated(dir, filepath.Join(dir, "merged", "openapi.yaml"))
+	lock.AddGenerated(dir, filepath.Join(t.TempDir(), "elsewhere.json"))
+	if want := []string{"manifest.json", "merged/openapi.yaml"}; !slices.Equal(lock.Generated, want) {
+		t.Errorf("Generated = %v, want %v", lock.Generated, want)
+	}
+
+	drift, err := Verify(dir, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 1 || drift[0].File != "notes.txt" || drift[0].Kind != DriftExtra {
+		t.Errorf("drift = %v, want only notes.txt as extra", drift)
+	}
+}
@@ -0,0 +1,91 @@
+package oam
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const versionLatest = "latest"
+
+// resolveVersion replaces symbolic versions with a concrete ref. "latest"
+// becomes the newest release tag, or the default branch if there are no
+// releases. A semver constraint becomes the highest matching tag. Other
+// versions are returned as is.
+func (f *Fetcher) resolveVersion(ctx context.Context, repoName string, r Repo) (Repo, error) {
+	if r.Version != versionLatest && !isConstraint(r.Version) {
+		return r, nil
+	}
+
+	key := fmt.Sprintf("%s/%s@%s", r.APIURL, r.URL, r.Version)
+	if v, ok := f.resolved.Load(key); ok {
+		r.Version = v.(string)
+		return r, nil
+	}
+
+	var tag string
+	var err error
+	if r.Version == versionLatest {
+		tag, err = f.resolveLatest(ctx, repoName, r)
+	} else {
+		tag, err = f.resolveConstraint(ctx, repoName, r)
+	}
+	if err != nil {
+		return r, err
+	}
+
+	f.resolved.Store(key, tag)
+	r.Version = tag
+	return r, nil
+}
+
+func (f *Fetcher) resolveLatest(ctx context.Context, repoName string, r Repo) (string, error) {
+	tag, ok, err := f.latestRelease(ctx, r)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to resolve latest release: %w", repoName, err)
+	}
+	if ok {
+		f.logger().Info("resolved version", "repo", repoName, "version", versionLatest, "tag", tag)
+		return tag, nil
+	}
+
+	tag, err = f.defaultBranch(ctx, r)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to resolve default branch: %w", repoName, err)
+	}
+	f.logger().Warn("no releases, using default branch", "repo", repoName, "branch", tag)
+	return tag, nil
+}
+
+// resolveConstraint returns the highest release tag satisfying the repo's
+// version constraint. Tags that aren't semver and prereleases are ignored.
+func (f *Fetcher) resolveConstraint(ctx context.Context, repoName string, r Repo) (string, error) {
+	c, err := parseConstraint(r.Version)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", repoName, err)
+	}
+	tags, err := f.listTags(ctx, r)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to list tags: %w", repoName, err)
+	}
+
+	var best string
+	var bestVersion semver
+	var considered []string
+	for _, tag := range tags {
+		v, ok := parseSemver(tag, false)
+		if !ok || v.Pre != "" {
+			continue
+		}
+		considered = append(considered, tag)
+		if c.matches(v) && (best == "" || v.compare(bestVersion) > 0) {
+			best, bestVersion = tag, v
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("%s: no tag satisfies %q (considered: %s)", repoName, r.Version, strings.Join(considered, ", "))
+	}
+
+	f.logger().Info("resolved version", "repo", repoName, "version", r.Version, "tag", best)
+	return best, nil
+}